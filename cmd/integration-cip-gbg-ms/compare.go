@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/diwise/service-chassis/pkg/infrastructure/env"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/compare"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/retry"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/serviceguiden"
+)
+
+// runCompare reports the sites that differ between two snapshots, or between a snapshot and the ServiceGuiden API
+func runCompare(ctx context.Context, args []string) error {
+	logger := logging.GetFromContext(ctx)
+
+	var fromFilePath, toFilePath, outFilePath, format, serviceTypes string
+	opts := compare.Options{}
+
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	fs.StringVar(&fromFilePath, "from", "", "The snapshot to compare from")
+	fs.StringVar(&toFilePath, "to", "", "The snapshot to compare to, the ServiceGuiden API is used if empty")
+	fs.StringVar(&serviceTypes, "types", "", "A comma separated list of service types to compare, all sites are compared if empty")
+	fs.Float64Var(&opts.MinDistance, "min-distance", 25, "Sites that have moved less than this many metres are not reported as moved")
+	fs.StringVar(&format, "format", "text", "The output format, text or json")
+	fs.StringVar(&outFilePath, "out", "-", "Write the differences to this file, use - for stdout")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if fromFilePath == "" {
+		return errors.New("a snapshot to compare from must be given with -from")
+	}
+
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown output format %s", format)
+	}
+
+	for _, t := range strings.Split(serviceTypes, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			opts.ServiceTypes = append(opts.ServiceTypes, t)
+		}
+	}
+
+	before, err := loadSites(ctx, fromFilePath)
+	if err != nil {
+		return err
+	}
+
+	after, err := loadSites(ctx, toFilePath)
+	if err != nil {
+		return err
+	}
+
+	sites := compare.Sites(before, after, opts)
+
+	to := toFilePath
+	if to == "" {
+		to = "serviceguiden"
+	}
+
+	logger.Info("comparison completed", slog.String("from", fromFilePath), slog.String("to", to), slog.Int("sites", len(sites)))
+
+	var w io.Writer = os.Stdout
+	if outFilePath != "-" {
+		f, err := os.Create(outFilePath)
+		if err != nil {
+			return fmt.Errorf("unable to create file %s: %w", outFilePath, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if format == "json" {
+		return compare.WriteJSON(w, sites)
+	}
+
+	return compare.WriteText(w, sites)
+}
+
+// loadSites reads all sites, including deleted ones, from a snapshot or from the ServiceGuiden API if filePath is empty
+func loadSites(ctx context.Context, filePath string) ([]serviceguiden.Content, error) {
+	var snapshot *serviceguiden.Snapshot
+	var err error
+
+	if filePath != "" {
+		snapshot, err = serviceguiden.LoadSnapshot(filePath)
+	} else {
+		serviceGuidenUrl := env.GetVariableOrDefault(ctx, "SERVICE_GUIDEN", "https://microservices.goteborg.se/sdw-service/api/internal/v1/sites?size=10000")
+
+		var policy retry.Policy
+		policy, err = retry.ParsePolicy(
+			env.GetVariableOrDefault(ctx, "RETRY_MAX_RETRIES", "3"),
+			env.GetVariableOrDefault(ctx, "RETRY_INITIAL_INTERVAL", "500ms"),
+			env.GetVariableOrDefault(ctx, "RETRY_MAX_INTERVAL", "30s"),
+			env.GetVariableOrDefault(ctx, "REQUEST_TIMEOUT", "30s"),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		snapshot, err = serviceguiden.TakeSnapshot(ctx, serviceGuidenUrl, serviceguiden.SnapshotOptions{}, serviceguiden.RetryPolicy(policy))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot.Sites()
+}
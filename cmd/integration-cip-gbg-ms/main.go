@@ -2,19 +2,36 @@ package main
 
 import (
 	"context"
-	"crypto/md5"
-	"encoding/hex"
 	"errors"
 	"flag"
 	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
-	"github.com/diwise/context-broker/pkg/datamodels/fiware"
 	"github.com/diwise/context-broker/pkg/ngsild/client"
-	"github.com/google/uuid"
 
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/advisory"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/attributes"
 	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/cip"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/description"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/geometry"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/hav"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/health"
 	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/lookup"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/mapping"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/metrics"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/pipeline"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/ratelimit"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/report"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/retry"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/scheduler"
 	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/serviceguiden"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/presentation/api"
 	"github.com/diwise/service-chassis/pkg/infrastructure/buildinfo"
 	"github.com/diwise/service-chassis/pkg/infrastructure/env"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
@@ -22,6 +39,13 @@ import (
 
 var lookupTableFilePath string
 var serviceGuidenFilePath string
+var geometryFilePath string
+var attributesFilePath string
+var mappingsFilePath string
+var advisoriesFilePath string
+var runOnce bool
+var dryRun bool
+var reportFilePath string
 
 const serviceName string = "integration-cip-gbg"
 
@@ -31,59 +55,357 @@ func main() {
 	ctx, logger, cleanup := o11y.Init(context.Background(), serviceName, serviceVersion)
 	defer cleanup()
 
+	if len(os.Args) > 1 && os.Args[1] == "match" {
+		err := runMatch(ctx, os.Args[2:])
+		if err != nil {
+			logger.Error("failed to match beaches", "err", err.Error())
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate-ids" {
+		err := runMigrateIDs(ctx, os.Args[2:])
+		if err != nil {
+			logger.Error("failed to migrate entity ids", "err", err.Error())
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "snapshot" {
+		err := runSnapshot(ctx, os.Args[2:])
+		if err != nil {
+			logger.Error("failed to take snapshot", "err", err.Error())
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "compare" {
+		err := runCompare(ctx, os.Args[2:])
+		if err != nil {
+			logger.Error("failed to compare snapshots", "err", err.Error())
+		}
+		return
+	}
+
 	flag.StringVar(&lookupTableFilePath, "references", "/opt/diwise/config/lookup.csv", "A file with cross-references from service guiden to nutscodes and devices")
 	flag.StringVar(&serviceGuidenFilePath, "sg", "/opt/diwise/config/serviceguiden.json", "A file with ServiceGuiden contents")
+	flag.StringVar(&geometryFilePath, "geometries", "/opt/diwise/config/geometries.geojson", "A GeoJSON file with beach polygons keyed by ServiceGuiden id")
+	flag.StringVar(&attributesFilePath, "attributes", "/opt/diwise/config/attributes.csv", "A file that maps ServiceGuiden attribute values to NGSI-LD properties, used for beaches when there is no mappings file")
+	flag.StringVar(&mappingsFilePath, "mappings", "/opt/diwise/config/mappings.yaml", "A file that maps ServiceGuiden service types to NGSI-LD entity types")
+	flag.StringVar(&advisoriesFilePath, "advisories", "/opt/diwise/config/advisories.yaml", "A file with rules that recognise notices, such as bathing advisories, in descriptions")
+	flag.BoolVar(&runOnce, "once", false, "Run a single sync and exit instead of running as a service")
+	flag.BoolVar(&dryRun, "dry-run", false, "Print what a single sync would change in the context broker, without writing anything")
+	flag.StringVar(&reportFilePath, "report", "", "Write a JSON report of each sync to this file, use - for stdout")
 	flag.Parse()
 
-	logger.Debug("args:", slog.String("references", lookupTableFilePath), slog.String("sg", serviceGuidenFilePath))
+	logger.Debug("args:", slog.String("references", lookupTableFilePath), slog.String("sg", serviceGuidenFilePath), slog.String("geometries", geometryFilePath), slog.String("attributes", attributesFilePath), slog.String("mappings", mappingsFilePath), slog.String("advisories", advisoriesFilePath))
 
 	serviceGuidenUrl := env.GetVariableOrDefault(ctx, "SERVICE_GUIDEN", "https://microservices.goteborg.se/sdw-service/api/internal/v1/sites?size=10000")
 	contextBrokerUrl := env.GetVariableOrDefault(ctx, "CONTEXT_BROKER", "http://context-broker")
+	bufferRadius := env.GetVariableOrDefault(ctx, "GEOMETRY_BUFFER_RADIUS", "50")
+	syncInterval := env.GetVariableOrDefault(ctx, "SYNC_INTERVAL", "1h")
+	syncCron := env.GetVariableOrDefault(ctx, "SYNC_CRON", "")
+	syncJitter := env.GetVariableOrDefault(ctx, "SYNC_JITTER", "0s")
+	reconcileMode := env.GetVariableOrDefault(ctx, "RECONCILE_MODE", string(cip.ReconcileRetire))
+	reconcileMaxFraction := env.GetVariableOrDefault(ctx, "RECONCILE_MAX_FRACTION", "0.2")
+	batchSize := env.GetVariableOrDefault(ctx, "BATCH_SIZE", "50")
+	lookupReloadInterval := env.GetVariableOrDefault(ctx, "LOOKUP_RELOAD_INTERVAL", "30s")
+	waterQualitySamples := env.GetVariableOrDefault(ctx, "WATER_QUALITY_SAMPLES", "0")
+	havProfileUrl := env.GetVariableOrDefault(ctx, "HAV_OCH_VATTEN_PROFILE_URL", hav.DefaultProfileURL)
+	descriptionFormats := env.GetVariableOrDefault(ctx, "DESCRIPTION_FORMATS", "html,text")
+	descriptionBaseUrl := env.GetVariableOrDefault(ctx, "DESCRIPTION_BASE_URL", "https://goteborg.se")
+	servicePort := env.GetVariableOrDefault(ctx, "SERVICE_PORT", "8080")
+	healthMaxSyncAge := env.GetVariableOrDefault(ctx, "HEALTH_MAX_SYNC_AGE", "3h")
+	retryMaxRetries := env.GetVariableOrDefault(ctx, "RETRY_MAX_RETRIES", "3")
+	retryInitialInterval := env.GetVariableOrDefault(ctx, "RETRY_INITIAL_INTERVAL", "500ms")
+	retryMaxInterval := env.GetVariableOrDefault(ctx, "RETRY_MAX_INTERVAL", "30s")
+	requestTimeout := env.GetVariableOrDefault(ctx, "REQUEST_TIMEOUT", "30s")
+	breakerThreshold := env.GetVariableOrDefault(ctx, "BREAKER_THRESHOLD", "5")
+	breakerCooldown := env.GetVariableOrDefault(ctx, "BREAKER_COOLDOWN", "1m")
+	syncConcurrency := env.GetVariableOrDefault(ctx, "SYNC_CONCURRENCY", "4")
+	brokerRateLimit := env.GetVariableOrDefault(ctx, "CONTEXT_BROKER_RATE_LIMIT", "25")
+	pageConcurrency := env.GetVariableOrDefault(ctx, "SERVICE_GUIDEN_PAGE_CONCURRENCY", "1")
 
-	logger.Debug("env:", slog.String("SERVICE_GUIDEN", serviceGuidenUrl), slog.String("CONTEXT_BROKER", contextBrokerUrl))
+	logger.Debug("env:", slog.String("SERVICE_GUIDEN", serviceGuidenUrl), slog.String("CONTEXT_BROKER", contextBrokerUrl), slog.String("GEOMETRY_BUFFER_RADIUS", bufferRadius),
+		slog.String("SYNC_INTERVAL", syncInterval), slog.String("SYNC_CRON", syncCron), slog.String("SYNC_JITTER", syncJitter),
+		slog.String("RECONCILE_MODE", reconcileMode), slog.String("RECONCILE_MAX_FRACTION", reconcileMaxFraction), slog.String("BATCH_SIZE", batchSize),
+		slog.String("LOOKUP_RELOAD_INTERVAL", lookupReloadInterval), slog.String("WATER_QUALITY_SAMPLES", waterQualitySamples),
+		slog.String("DESCRIPTION_FORMATS", descriptionFormats), slog.String("DESCRIPTION_BASE_URL", descriptionBaseUrl), slog.String("SERVICE_PORT", servicePort),
+		slog.String("HEALTH_MAX_SYNC_AGE", healthMaxSyncAge), slog.String("RETRY_MAX_RETRIES", retryMaxRetries), slog.String("RETRY_INITIAL_INTERVAL", retryInitialInterval),
+		slog.String("RETRY_MAX_INTERVAL", retryMaxInterval), slog.String("REQUEST_TIMEOUT", requestTimeout), slog.String("BREAKER_THRESHOLD", breakerThreshold),
+		slog.String("BREAKER_COOLDOWN", breakerCooldown), slog.String("SYNC_CONCURRENCY", syncConcurrency), slog.String("CONTEXT_BROKER_RATE_LIMIT", brokerRateLimit),
+		slog.String("SERVICE_GUIDEN_PAGE_CONCURRENCY", pageConcurrency))
 
-	cbClient := client.NewContextBrokerClient(contextBrokerUrl)
-	sgClient := serviceguiden.New(ctx, serviceGuidenUrl, serviceGuidenFilePath)
-	lookupTable := lookup.New(logger, lookupTableFilePath)
+	radius, err := strconv.ParseFloat(bufferRadius, 64)
+	if err != nil {
+		logger.Error("invalid buffer radius", slog.String("GEOMETRY_BUFFER_RADIUS", bufferRadius), "err", err.Error())
+		return
+	}
 
-	err := run(ctx, sgClient, lookupTable, cbClient, logger)
+	mode, err := cip.ParseReconcileMode(reconcileMode)
 	if err != nil {
-		logger.Error("failed to create or update beaches", "err", err.Error())
+		logger.Error("invalid reconcile mode", slog.String("RECONCILE_MODE", reconcileMode), "err", err.Error())
+		return
+	}
+
+	maxFraction, err := strconv.ParseFloat(reconcileMaxFraction, 64)
+	if err != nil {
+		logger.Error("invalid reconcile max fraction", slog.String("RECONCILE_MAX_FRACTION", reconcileMaxFraction), "err", err.Error())
+		return
+	}
+
+	chunkSize, err := strconv.Atoi(batchSize)
+	if err != nil || chunkSize < 0 {
+		logger.Error("invalid batch size", slog.String("BATCH_SIZE", batchSize))
+		return
+	}
+
+	samples, err := strconv.Atoi(waterQualitySamples)
+	if err != nil || samples < 0 {
+		logger.Error("invalid number of water quality samples", slog.String("WATER_QUALITY_SAMPLES", waterQualitySamples))
+		return
+	}
+
+	retryPolicy, err := retry.ParsePolicy(retryMaxRetries, retryInitialInterval, retryMaxInterval, requestTimeout)
+	if err != nil {
+		logger.Error("invalid retry policy", "err", err.Error())
+		return
+	}
+
+	threshold, err := strconv.Atoi(breakerThreshold)
+	if err != nil || threshold < 0 {
+		logger.Error("invalid circuit breaker threshold", slog.String("BREAKER_THRESHOLD", breakerThreshold))
+		return
+	}
+
+	cooldown, err := time.ParseDuration(breakerCooldown)
+	if err != nil {
+		logger.Error("invalid circuit breaker cooldown", slog.String("BREAKER_COOLDOWN", breakerCooldown), "err", err.Error())
+		return
+	}
+
+	concurrency, err := strconv.Atoi(syncConcurrency)
+	if err != nil || concurrency < 1 {
+		logger.Error("invalid sync concurrency", slog.String("SYNC_CONCURRENCY", syncConcurrency))
+		return
+	}
+
+	pages, err := strconv.Atoi(pageConcurrency)
+	if err != nil || pages < 1 {
+		logger.Error("invalid page concurrency", slog.String("SERVICE_GUIDEN_PAGE_CONCURRENCY", pageConcurrency))
+		return
+	}
+
+	requestsPerSecond, err := strconv.ParseFloat(brokerRateLimit, 64)
+	if err != nil || requestsPerSecond < 0 {
+		logger.Error("invalid context broker rate limit", slog.String("CONTEXT_BROKER_RATE_LIMIT", brokerRateLimit))
+		return
+	}
+
+	formats, err := description.ParseFormats(descriptionFormats)
+	if err != nil {
+		logger.Error("invalid description formats", slog.String("DESCRIPTION_FORMATS", descriptionFormats), "err", err.Error())
+		return
+	}
+
+	baseUrl, err := url.Parse(descriptionBaseUrl)
+	if err != nil || !baseUrl.IsAbs() || baseUrl.Host == "" {
+		logger.Error("invalid description base url, an absolute url is required", slog.String("DESCRIPTION_BASE_URL", descriptionBaseUrl))
+		return
+	}
+
+	geometries, err := geometry.New(ctx, geometryFilePath, radius)
+	if err != nil {
+		logger.Error("failed to load geometries", "err", err.Error())
+		return
+	}
+
+	lookupTable, err := lookup.NewReloadable(lookupTableFilePath)
+	if err != nil {
+		logger.Error("failed to load lookup table", "err", err.Error())
+		return
+	}
+
+	mappings, err := loadMappings(mappingsFilePath, attributesFilePath)
+	if err != nil {
+		logger.Error("failed to load mappings", "err", err.Error())
+		return
 	}
-}
 
-func run(ctx context.Context, sgClient serviceguiden.ServiceGuidenClient, lookupTable lookup.LookupTable, cbClient client.ContextBrokerClient, logger *slog.Logger) error {
-	badplatser, err := sgClient.Badplatser(ctx)
+	advisories, err := advisory.Load(advisoriesFilePath)
 	if err != nil {
+		logger.Error("failed to load advisory rules", "err", err.Error())
+		return
+	}
+
+	// each attempt of a request to the context broker is rate limited and instrumented. The rate limit is waited
+	// for before the timeout of an attempt starts, so that a throttled run does not look like a failing broker.
+	limiter := ratelimit.NewPerHost(requestsPerSecond)
+	cbClient := metrics.InstrumentContextBroker(client.NewContextBrokerClient(contextBrokerUrl))
+
+	cfg := pipeline.Config{
+		LookupTable:  lookupTable,
+		Geometries:   geometries,
+		Mappings:     mappings,
+		Advisories:   advisories,
+		Descriptions: cip.Descriptions{Formats: formats, BaseURL: baseUrl},
+		CBClient:     retry.ContextBroker(cbClient, retryPolicy, retry.NewBreaker(threshold, cooldown), retry.RateLimit(limiter.WaitFor(contextBrokerUrl))),
+		Reconcile:    cip.ReconcileOptions{Mode: mode, MaxFraction: maxFraction},
+		DryRun:       dryRun,
+		BatchClient:  cip.NewBatchClient(contextBrokerUrl, cip.BatchRateLimit(limiter), cip.BatchRetryPolicy(retryPolicy)),
+		BatchSize:    chunkSize,
+		Concurrency:  concurrency,
+	}
+
+	if samples > 0 {
+		cfg.WaterQuality = hav.NewClient(havProfileUrl)
+		cfg.WaterQualitySamples = samples
+	}
+
+	// a new client is created for each sync so that contents are fetched again from ServiceGuiden
+	runner := pipeline.NewRunner(cfg, func(ctx context.Context) serviceguiden.ServiceGuidenClient {
+		return serviceguiden.New(ctx, serviceGuidenUrl, serviceGuidenFilePath, serviceguiden.RetryPolicy(retryPolicy), serviceguiden.PageConcurrency(pages))
+	})
+
+	syncSites := func(ctx context.Context, sourceID string) error {
+		rpt, err := runner.Run(ctx, sourceID)
+		logger.Info("sync completed", slog.String("id", sourceID), slog.Bool("dry_run", rpt.DryRun), slog.Int("created", rpt.Count(report.Created)), slog.Int("updated", rpt.Count(report.Merged)),
+			slog.Int("skipped", rpt.Count(report.Unchanged)), slog.Int("warnings", rpt.Warnings()), slog.Int("errors", rpt.Errors()),
+			slog.Int("deleted", rpt.Count(report.Deleted)), slog.Int("retired", rpt.Count(report.Retired)))
+
+		if dryRun {
+			if err := rpt.WriteText(os.Stdout); err != nil {
+				logger.Error("failed to write dry run output", "err", err.Error())
+			}
+		}
+
+		if reportFilePath != "" {
+			if err := writeReport(rpt, reportFilePath); err != nil {
+				logger.Error("failed to write report", slog.String("report", reportFilePath), "err", err.Error())
+			}
+		}
+
 		return err
 	}
 
-	errs := []error{}
+	syncBeaches := func(ctx context.Context) error {
+		return syncSites(ctx, "")
+	}
+
+	if runOnce || dryRun {
+		err = syncBeaches(ctx)
+		if err != nil {
+			logger.Error("failed to create or update beaches", "err", err.Error())
+		}
+		return
+	}
+
+	schedule, err := scheduler.ParseSchedule(syncInterval, syncCron)
+	if err != nil {
+		logger.Error("invalid sync schedule", "err", err.Error())
+		return
+	}
+
+	jitter, err := time.ParseDuration(syncJitter)
+	if err != nil {
+		logger.Error("invalid sync jitter", slog.String("SYNC_JITTER", syncJitter), "err", err.Error())
+		return
+	}
+
+	reloadInterval, err := time.ParseDuration(lookupReloadInterval)
+	if err != nil {
+		logger.Error("invalid lookup reload interval", slog.String("LOOKUP_RELOAD_INTERVAL", lookupReloadInterval), "err", err.Error())
+		return
+	}
+
+	maxSyncAge, err := time.ParseDuration(healthMaxSyncAge)
+	if err != nil {
+		logger.Error("invalid max sync age", slog.String("HEALTH_MAX_SYNC_AGE", healthMaxSyncAge), "err", err.Error())
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if reloadInterval > 0 {
+		go lookupTable.Watch(ctx, reloadInterval)
+	}
+
+	s := scheduler.New(syncBeaches, schedule, jitter)
+
+	server := &http.Server{
+		Addr: ":" + servicePort,
+		Handler: api.New(ctx, &syncer{
+			Runner: runner,
+			start: func(ctx context.Context, sourceID string) error {
+				return s.Start(ctx, func(ctx context.Context) error { return syncSites(ctx, sourceID) })
+			},
+		}, health.NewChecker(lookupTable, metrics.LastSuccess, maxSyncAge)),
+	}
+
+	go func() {
+		logger.Info("starting admin api", slog.String("port", servicePort))
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("admin api failed", "err", err.Error())
+		}
+	}()
+
+	err = s.Run(ctx)
+	if err != nil {
+		logger.Error("scheduler failed", "err", err.Error())
+	}
 
-	for _, badplats := range badplatser {
-		nutsCode, _ := lookupTable.GetNutsCode(badplats.ID())
-		props := cip.NewBeachProps(badplats, nutsCode)
-		beachID := fiware.BeachIDPrefix + deterministicGUID("ServiceGuiden", badplats.ID())
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
 
-		err := cip.MergeOrCreate(ctx, cbClient, beachID, fiware.BeachTypeName, props)
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("failed to shut down admin api", "err", err.Error())
+	}
+
+	// a sync may have been started through the admin api while the scheduler was stopping
+	s.Wait()
+
+	logger.Info("shutting down")
+}
+
+// syncer lets the admin api start syncs through the scheduler, so that they never overlap with scheduled syncs
+type syncer struct {
+	*pipeline.Runner
+	start func(ctx context.Context, sourceID string) error
+}
+
+func (s *syncer) Start(ctx context.Context, sourceID string) error {
+	if sourceID != "" {
+		if err := s.FindSite(ctx, sourceID); err != nil {
+			return err
+		}
+	}
+	return s.start(ctx, sourceID)
+}
+
+// loadMappings loads the service type mappings, or only maps beaches if there is no mappings file
+func loadMappings(mappingsFilePath, attributesFilePath string) ([]mapping.ServiceType, error) {
+	if _, err := os.Stat(mappingsFilePath); errors.Is(err, os.ErrNotExist) {
+		attributeMapper, err := attributes.Load(attributesFilePath)
 		if err != nil {
-			logger.Error("faild to merge beach", slog.String("beach_id", beachID), slog.String("err", err.Error()))
-			errs = append(errs, err)
+			return nil, err
 		}
+		return mapping.Default(attributeMapper), nil
 	}
 
-	return errors.Join(errs...)
+	return mapping.Load(mappingsFilePath)
 }
 
-func deterministicGUID(dataProvider string, id string) string {
-	md5hash := md5.New()
-	md5hash.Write([]byte(id + dataProvider))
-	md5string := hex.EncodeToString(md5hash.Sum(nil))
+func writeReport(rpt *report.Report, filePath string) error {
+	if filePath == "-" {
+		return rpt.WriteJSON(os.Stdout)
+	}
 
-	unique, err := uuid.FromBytes([]byte(md5string[0:16]))
+	f, err := os.Create(filePath)
 	if err != nil {
-		return uuid.New().String()
+		return err
 	}
+	defer f.Close()
 
-	return unique.String()
+	return rpt.WriteJSON(f)
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/hav"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/lookup"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/matching"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/serviceguiden"
+	"github.com/diwise/service-chassis/pkg/infrastructure/env"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+)
+
+// runMatch proposes NUTS codes for beaches that are missing in the lookup table and writes them as a candidate lookup table
+func runMatch(ctx context.Context, args []string) error {
+	logger := logging.GetFromContext(ctx)
+
+	var havFilePath, lookupTableFilePath, serviceGuidenFilePath, outFilePath string
+	var includeMapped bool
+	opts := matching.DefaultOptions()
+
+	fs := flag.NewFlagSet("match", flag.ContinueOnError)
+	fs.StringVar(&havFilePath, "hav", "", "A JSON or CSV export of bathing sites from Havs- och vattenmyndigheten")
+	fs.StringVar(&lookupTableFilePath, "references", "/opt/diwise/config/lookup.csv", "A file with cross-references from service guiden to nutscodes and devices")
+	fs.StringVar(&serviceGuidenFilePath, "sg", "/opt/diwise/config/serviceguiden.json", "A file with ServiceGuiden contents")
+	fs.StringVar(&outFilePath, "out", "-", "Write the candidate lookup table to this file, use - for stdout")
+	fs.BoolVar(&includeMapped, "all", false, "Also propose NUTS codes for beaches that already have one")
+	fs.Float64Var(&opts.MaxDistance, "max-distance", opts.MaxDistance, "Bathing sites further away than this many metres are never proposed")
+	fs.Float64Var(&opts.MinConfidence, "min-confidence", opts.MinConfidence, "The lowest confidence, between 0 and 1, for a NUTS code to be proposed")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if havFilePath == "" {
+		return errors.New("a bathing site export must be given with -hav")
+	}
+
+	bathingSites, err := hav.LoadBathingSites(havFilePath)
+	if err != nil {
+		return err
+	}
+
+	lookupTable, err := lookup.New(lookupTableFilePath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		logger.Warn("lookup table not found, all beaches are treated as unmapped", slog.String("references", lookupTableFilePath))
+	}
+
+	serviceGuidenUrl := env.GetVariableOrDefault(ctx, "SERVICE_GUIDEN", "https://microservices.goteborg.se/sdw-service/api/internal/v1/sites?size=10000")
+
+	badplatser, err := serviceguiden.New(ctx, serviceGuidenUrl, serviceGuidenFilePath).Badplatser(ctx)
+	if err != nil {
+		return err
+	}
+
+	deviceID := func(serviceGuidenID string) string {
+		if lookupTable == nil {
+			return ""
+		}
+		id, _ := lookupTable.GetDeviceId(serviceGuidenID)
+		return id
+	}
+
+	candidates := []matching.Candidate{}
+	matched := 0
+
+	for _, b := range badplatser {
+		if lookupTable != nil && !includeMapped {
+			if _, ok := lookupTable.GetNutsCode(b.ID()); ok {
+				continue
+			}
+		}
+
+		proposed := matching.Match(b, bathingSites, opts)
+		if len(proposed) == 0 {
+			logger.Info("no NUTS code found", slog.String("serviceguiden_id", b.ID()), slog.String("name", b.Name()))
+			// beaches without a candidate are kept in the output so that they can be completed by hand
+			candidates = append(candidates, matching.Candidate{ServiceGuidenID: b.ID(), Name: b.Name()})
+			continue
+		}
+
+		matched++
+		candidates = append(candidates, proposed[0])
+	}
+
+	logger.Info("matching completed", slog.Int("beaches", len(candidates)), slog.Int("matched", matched))
+
+	var w io.Writer = os.Stdout
+	if outFilePath != "-" {
+		f, err := os.Create(outFilePath)
+		if err != nil {
+			return fmt.Errorf("unable to create file %s: %w", outFilePath, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return matching.WriteCSV(w, candidates, deviceID)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+	"github.com/diwise/service-chassis/pkg/infrastructure/env"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/migration"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/report"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/serviceguiden"
+)
+
+// runMigrateIDs moves entities that were published with the old ids to their current ids. The mapping from
+// old to new ids is written before anything is changed in the context broker.
+func runMigrateIDs(ctx context.Context, args []string) error {
+	logger := logging.GetFromContext(ctx)
+
+	var serviceGuidenFilePath, attributesFilePath, mappingsFilePath, planFilePath, reportFilePath string
+	var dryRun bool
+
+	fs := flag.NewFlagSet("migrate-ids", flag.ContinueOnError)
+	fs.StringVar(&serviceGuidenFilePath, "sg", "/opt/diwise/config/serviceguiden.json", "A file with ServiceGuiden contents")
+	fs.StringVar(&attributesFilePath, "attributes", "/opt/diwise/config/attributes.csv", "A file that maps ServiceGuiden attribute values to NGSI-LD properties, used for beaches when there is no mappings file")
+	fs.StringVar(&mappingsFilePath, "mappings", "/opt/diwise/config/mappings.yaml", "A file that maps ServiceGuiden service types to NGSI-LD entity types")
+	fs.StringVar(&planFilePath, "out", "-", "Write the mapping from old to new ids to this file, use - for stdout")
+	fs.BoolVar(&dryRun, "dry-run", false, "Only write the mapping from old to new ids, without migrating any entities")
+	fs.StringVar(&reportFilePath, "report", "", "Write a JSON report of the migration to this file, use - for stdout")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	mappings, err := loadMappings(mappingsFilePath, attributesFilePath)
+	if err != nil {
+		return err
+	}
+
+	serviceGuidenUrl := env.GetVariableOrDefault(ctx, "SERVICE_GUIDEN", "https://microservices.goteborg.se/sdw-service/api/internal/v1/sites?size=10000")
+	contextBrokerUrl := env.GetVariableOrDefault(ctx, "CONTEXT_BROKER", "http://context-broker")
+
+	cbClient := client.NewContextBrokerClient(contextBrokerUrl)
+
+	plan, err := migration.Plan(ctx, serviceguiden.New(ctx, serviceGuidenUrl, serviceGuidenFilePath), cbClient, mappings)
+	if err != nil {
+		return err
+	}
+
+	err = writePlan(plan, planFilePath)
+	if err != nil {
+		return fmt.Errorf("unable to write id mapping to %s: %w", planFilePath, err)
+	}
+
+	logger.Info("id migration planned", slog.Int("entities", len(plan)), slog.Bool("dry_run", dryRun))
+
+	if dryRun || len(plan) == 0 {
+		return nil
+	}
+
+	rpt := report.New(false)
+	err = migration.Apply(ctx, cbClient, plan, rpt)
+	rpt.Finish()
+
+	logger.Info("id migration completed", slog.Int("created", rpt.Count(report.Created)), slog.Int("deleted", rpt.Count(report.Deleted)),
+		slog.Int("references", rpt.Count(report.Merged)), slog.Int("errors", rpt.Errors()))
+
+	if reportFilePath != "" {
+		if err := writeReport(rpt, reportFilePath); err != nil {
+			logger.Error("failed to write report", slog.String("report", reportFilePath), "err", err.Error())
+		}
+	}
+
+	return err
+}
+
+func writePlan(plan []migration.Migration, filePath string) error {
+	var w io.Writer = os.Stdout
+	if filePath != "-" {
+		f, err := os.Create(filePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return migration.WriteCSV(w, plan)
+}
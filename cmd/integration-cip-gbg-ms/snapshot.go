@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/diwise/service-chassis/pkg/infrastructure/env"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/retry"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/serviceguiden"
+)
+
+// runSnapshot fetches the contents of ServiceGuiden and writes them to a file that can be replayed with -sg
+func runSnapshot(ctx context.Context, args []string) error {
+	logger := logging.GetFromContext(ctx)
+
+	var outPath, serviceTypes string
+	var compress, redact bool
+
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	fs.StringVar(&outPath, "out", ".", "Write the snapshot to this file, or to a timestamped file in this directory, use - for stdout")
+	fs.BoolVar(&compress, "gzip", false, "Compress the snapshot with gzip")
+	fs.StringVar(&serviceTypes, "types", "", "A comma separated list of service types to keep, all sites are kept if empty")
+	fs.BoolVar(&redact, "redact", true, "Remove names, phone numbers and email addresses of contacts and users")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	serviceGuidenUrl := env.GetVariableOrDefault(ctx, "SERVICE_GUIDEN", "https://microservices.goteborg.se/sdw-service/api/internal/v1/sites?size=10000")
+
+	policy, err := retry.ParsePolicy(
+		env.GetVariableOrDefault(ctx, "RETRY_MAX_RETRIES", "3"),
+		env.GetVariableOrDefault(ctx, "RETRY_INITIAL_INTERVAL", "500ms"),
+		env.GetVariableOrDefault(ctx, "RETRY_MAX_INTERVAL", "30s"),
+		env.GetVariableOrDefault(ctx, "REQUEST_TIMEOUT", "30s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	opts := serviceguiden.SnapshotOptions{Redact: redact}
+	for _, t := range strings.Split(serviceTypes, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			opts.ServiceTypes = append(opts.ServiceTypes, t)
+		}
+	}
+
+	snapshot, err := serviceguiden.TakeSnapshot(ctx, serviceGuidenUrl, opts, serviceguiden.RetryPolicy(policy))
+	if err != nil {
+		return err
+	}
+
+	filePath, err := writeSnapshot(snapshot, outPath, compress)
+	if err != nil {
+		return fmt.Errorf("unable to write snapshot to %s: %w", outPath, err)
+	}
+
+	logger.Info("snapshot written", slog.String("file", filePath), slog.Int("sites", len(snapshot.Contents)), slog.Bool("redacted", snapshot.Redacted))
+
+	return nil
+}
+
+func writeSnapshot(snapshot *serviceguiden.Snapshot, outPath string, compress bool) (string, error) {
+	var w io.Writer = os.Stdout
+
+	if outPath != "-" {
+		info, err := os.Stat(outPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		if info != nil && info.IsDir() {
+			outPath = filepath.Join(outPath, snapshot.FileName(compress))
+		}
+
+		f, err := os.Create(outPath)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return outPath, snapshot.Write(w, compress)
+}
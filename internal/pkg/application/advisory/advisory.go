@@ -0,0 +1,303 @@
+package advisory
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+	"github.com/diwise/context-broker/pkg/ngsild/types/properties"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/description"
+	"gopkg.in/yaml.v3"
+)
+
+// Rule recognises a kind of notice in descriptions. A sentence is a notice if it matches any of
+// the patterns and none of the exclude patterns. Patterns are case insensitive regular expressions.
+type Rule struct {
+	Property string   `yaml:"property"`
+	Patterns []string `yaml:"patterns"`
+	Exclude  []string `yaml:"exclude"`
+
+	patterns []*regexp.Regexp
+	exclude  []*regexp.Regexp
+}
+
+// Notice is a notice found in a description. ValidFrom and ValidThrough are zero if no dates were found.
+type Notice struct {
+	Property     string    `json:"property"`
+	ValidFrom    time.Time `json:"validFrom,omitempty"`
+	ValidThrough time.Time `json:"validThrough,omitempty"`
+	Sentence     string    `json:"sentence"`
+}
+
+type Extractor interface {
+	// Extract returns the notices in an HTML description. Dates without a year are assumed to be in the same year as reference.
+	Extract(description string, reference time.Time) []Notice
+	// Properties returns the property of each rule
+	Properties() []string
+}
+
+type extractor struct {
+	rules []Rule
+}
+
+type config struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+func New(rules []Rule) (Extractor, error) {
+	for idx := range rules {
+		r := &rules[idx]
+
+		if r.Property == "" || len(r.Patterns) == 0 {
+			return nil, fmt.Errorf("rule %d: property and patterns must not be empty", idx+1)
+		}
+
+		for _, p := range r.Patterns {
+			re, err := regexp.Compile("(?i)" + p)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid pattern: %w", idx+1, err)
+			}
+			r.patterns = append(r.patterns, re)
+		}
+
+		for _, p := range r.Exclude {
+			re, err := regexp.Compile("(?i)" + p)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid exclude pattern: %w", idx+1, err)
+			}
+			r.exclude = append(r.exclude, re)
+		}
+	}
+
+	return &extractor{rules: rules}, nil
+}
+
+// Load reads rules from a yaml file. A missing file results in an extractor without rules.
+func Load(filePath string) (Extractor, error) {
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return New(nil)
+		}
+		return nil, fmt.Errorf("unable to read file %s: %w", filePath, err)
+	}
+
+	var cfg config
+	err = yaml.Unmarshal(b, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse file %s: %w", filePath, err)
+	}
+
+	e, err := New(cfg.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load rules from file %s: %w", filePath, err)
+	}
+
+	return e, nil
+}
+
+func (e *extractor) Extract(description string, reference time.Time) []Notice {
+	notices := []Notice{}
+
+	if len(e.rules) == 0 {
+		return notices
+	}
+
+	sentences := Sentences(description)
+
+	for _, r := range e.rules {
+		var found *Notice
+
+		for _, s := range sentences {
+			if !r.matches(s) {
+				continue
+			}
+
+			from, through := Dates(s, reference)
+			n := &Notice{Property: r.Property, ValidFrom: from, ValidThrough: through, Sentence: s}
+
+			// the first sentence with dates is the most specific one, otherwise the first match is used
+			if found == nil || (found.ValidFrom.IsZero() && found.ValidThrough.IsZero() && !(from.IsZero() && through.IsZero())) {
+				found = n
+			}
+		}
+
+		if found != nil {
+			notices = append(notices, *found)
+		}
+	}
+
+	return notices
+}
+
+func (e *extractor) Properties() []string {
+	properties := []string{}
+	for _, r := range e.rules {
+		properties = append(properties, r.Property)
+	}
+	return properties
+}
+
+func (r Rule) matches(sentence string) bool {
+	for _, re := range r.exclude {
+		if re.MatchString(sentence) {
+			return false
+		}
+	}
+
+	for _, re := range r.patterns {
+		if re.MatchString(sentence) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Decorators returns a boolean property for each of the properties, that is true if there is a notice
+// for it and false otherwise. The dates of notices are published as <property>ValidFrom and <property>ValidThrough.
+func Decorators(properties []string, notices []Notice) []entities.EntityDecoratorFunc {
+	props := []entities.EntityDecoratorFunc{}
+
+	found := map[string]bool{}
+	for _, n := range notices {
+		found[n.Property] = true
+	}
+
+	for _, property := range properties {
+		props = append(props, entities.P(property, NewBooleanProperty(found[property])))
+	}
+
+	for _, n := range notices {
+		validFrom, validThrough := DateProperties(n.Property)
+
+		if !n.ValidFrom.IsZero() {
+			props = append(props, decorators.DateTime(validFrom, n.ValidFrom.Format(time.RFC3339)))
+		}
+
+		if !n.ValidThrough.IsZero() {
+			props = append(props, decorators.DateTime(validThrough, n.ValidThrough.Format(time.RFC3339)))
+		}
+	}
+
+	return props
+}
+
+// DateProperties returns the names of the date properties that may be published for a property
+func DateProperties(property string) (validFrom, validThrough string) {
+	return property + "ValidFrom", property + "ValidThrough"
+}
+
+// BooleanProperty holds a bool value, which the properties of the context broker client lack
+type BooleanProperty struct {
+	properties.PropertyImpl
+	Val bool `json:"value"`
+}
+
+func (bp *BooleanProperty) Type() string {
+	return bp.PropertyImpl.Type
+}
+
+func (bp *BooleanProperty) Value() any {
+	return bp.Val
+}
+
+func NewBooleanProperty(value bool) *BooleanProperty {
+	return &BooleanProperty{
+		PropertyImpl: properties.PropertyImpl{Type: "Property"},
+		Val:          value,
+	}
+}
+
+var sentenceEnd = regexp.MustCompile(`[.!?]\s+`)
+
+// Sentences returns the sentences of the text in an HTML description. Headings and other blocks are sentences of their own.
+func Sentences(html string) []string {
+	sentences := []string{}
+
+	for _, block := range strings.Split(description.PlainText(html), "\n") {
+		for _, s := range sentenceEnd.Split(block, -1) {
+			s = strings.Join(strings.Fields(s), " ")
+			s = strings.TrimSuffix(s, ".")
+			if s != "" {
+				sentences = append(sentences, s)
+			}
+		}
+	}
+
+	return sentences
+}
+
+var months = map[string]time.Month{
+	"januari": time.January, "februari": time.February, "mars": time.March, "april": time.April,
+	"maj": time.May, "juni": time.June, "juli": time.July, "augusti": time.August,
+	"september": time.September, "oktober": time.October, "november": time.November, "december": time.December,
+}
+
+const (
+	monthPattern = `(januari|februari|mars|april|maj|juni|juli|augusti|september|oktober|november|december)`
+	datePattern  = `(\d{1,2})\s*` + monthPattern + `(?:\s+(\d{4}))?`
+)
+
+var (
+	// 1 maj och 15 september, 15 maj-15 september, 1-15 maj
+	rangePattern = regexp.MustCompile(`(?i)(\d{1,2})\s*` + monthPattern + `?(?:\s+(\d{4}))?\s*(?:-|–|och|till)\s*` + datePattern)
+	// från och med 13 augusti, fr.o.m. 13 augusti
+	fromPattern = regexp.MustCompile(`(?i)(?:från och med|fr\.\s?o\.\s?m\.?|från)\s+` + datePattern)
+	// fram till 10 juni, till och med 10 juni
+	throughPattern = regexp.MustCompile(`(?i)(?:till och med|t\.\s?o\.\s?m\.?|fram till|till)\s+` + datePattern)
+)
+
+// Dates returns the first date range in a Swedish sentence. A single "från och med" date only sets from,
+// and a single "fram till" date only sets through. Dates without a year are placed in the year of reference.
+func Dates(sentence string, reference time.Time) (from, through time.Time) {
+	year := reference.Year()
+
+	if m := rangePattern.FindStringSubmatch(sentence); m != nil {
+		throughMonth := months[strings.ToLower(m[5])]
+		fromMonth := throughMonth
+		if m[2] != "" {
+			fromMonth = months[strings.ToLower(m[2])]
+		}
+
+		fromYear := m[3]
+		if fromYear == "" {
+			fromYear = m[6]
+		}
+
+		from = date(m[1], fromMonth, fromYear, year)
+		through = date(m[4], throughMonth, m[6], year)
+
+		if through.Before(from) && m[6] == "" {
+			// a range over new year, such as 1 oktober-30 april
+			through = through.AddDate(1, 0, 0)
+		}
+
+		return from, through
+	}
+
+	if m := fromPattern.FindStringSubmatch(sentence); m != nil {
+		from = date(m[1], months[strings.ToLower(m[2])], m[3], year)
+	}
+
+	if m := throughPattern.FindStringSubmatch(sentence); m != nil {
+		through = date(m[1], months[strings.ToLower(m[2])], m[3], year)
+	}
+
+	return from, through
+}
+
+func date(day string, month time.Month, year string, defaultYear int) time.Time {
+	d, _ := strconv.Atoi(day)
+	y, err := strconv.Atoi(year)
+	if err != nil {
+		y = defaultYear
+	}
+	return time.Date(y, month, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,97 @@
+package advisory
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/matryer/is"
+)
+
+func TestExtract(t *testing.T) {
+	is := is.New(t)
+
+	e, err := Load("../../../../assets/config/advisories.yaml")
+	is.NoErr(err)
+
+	reference := time.Date(2024, time.August, 20, 0, 0, 0, 0, time.UTC)
+	notices := e.Extract(askimsbadet, reference)
+
+	is.Equal(3, len(notices))
+
+	is.Equal("bathingAdvisory", notices[0].Property)
+	is.Equal(time.Date(2024, time.August, 13, 0, 0, 0, 0, time.UTC), notices[0].ValidFrom)
+	is.True(notices[0].ValidThrough.IsZero())
+
+	is.Equal("dogBan", notices[1].Property)
+	is.Equal(time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC), notices[1].ValidFrom)
+	is.Equal(time.Date(2024, time.September, 15, 0, 0, 0, 0, time.UTC), notices[1].ValidThrough)
+
+	is.Equal("seasonalToilets", notices[2].Property)
+}
+
+func TestExtractExcludesSentences(t *testing.T) {
+	is := is.New(t)
+
+	e, err := Load("../../../../assets/config/advisories.yaml")
+	is.NoErr(err)
+
+	notices := e.Extract("<p>Friluftstoaletter är öppna hela året.</p>", time.Now())
+	is.Equal(0, len(notices))
+
+	notices = e.Extract("<p>Friluftstoalett öppen dygnet runt 15 maj-15 september.</p>", time.Now())
+	is.Equal(1, len(notices))
+	is.Equal(time.May, notices[0].ValidFrom.Month())
+	is.Equal(time.September, notices[0].ValidThrough.Month())
+}
+
+func TestDecorators(t *testing.T) {
+	is := is.New(t)
+
+	notices := []Notice{{Property: "dogBan", ValidFrom: time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)}}
+
+	fragment, err := entities.NewFragment(Decorators([]string{"bathingAdvisory", "dogBan"}, notices)...)
+	is.NoErr(err)
+
+	b, err := fragment.MarshalJSON()
+	is.NoErr(err)
+
+	is.True(strings.Contains(string(b), `"bathingAdvisory":{"type":"Property","value":false}`))
+	is.True(strings.Contains(string(b), `"dogBan":{"type":"Property","value":true}`))
+	is.True(strings.Contains(string(b), `"dogBanValidFrom"`))
+	is.True(!strings.Contains(string(b), `"bathingAdvisoryValidFrom"`))
+}
+
+func TestDates(t *testing.T) {
+	is := is.New(t)
+
+	reference := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	from, through := Dates("Hundförbud mellan 1 oktober och 30 april", reference)
+	is.Equal(time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC), from)
+	is.Equal(time.Date(2025, time.April, 30, 0, 0, 0, 0, time.UTC), through)
+
+	from, through = Dates("Invigdes 2–5 juni 2023", reference)
+	is.Equal(time.Date(2023, time.June, 2, 0, 0, 0, 0, time.UTC), from)
+	is.Equal(time.Date(2023, time.June, 5, 0, 0, 0, 0, time.UTC), through)
+
+	from, through = Dates("Badstegen är avstängd fram till 10 juni", reference)
+	is.True(from.IsZero())
+	is.Equal(time.Date(2024, time.June, 10, 0, 0, 0, 0, time.UTC), through)
+
+	from, through = Dates("Från hållplatsen är det 290 meter till badplatsen", reference)
+	is.True(from.IsZero() && through.IsZero())
+}
+
+func TestNewRejectsInvalidRules(t *testing.T) {
+	is := is.New(t)
+
+	_, err := New([]Rule{{Property: "dogBan"}})
+	is.True(err != nil)
+
+	_, err = New([]Rule{{Property: "dogBan", Patterns: []string{"("}}})
+	is.True(err != nil)
+}
+
+const askimsbadet string = "<p><strong>Avrådan från bad vid Askimsbadet</strong></p>\r\n<p><span>På grund av höga bakteriehalter har Göteborgs Stad beslutat om avrådan från bad vid Askimsbadet från och med 13 augusti. Avrådan från bad gäller till dess att vattenproverna visar att vattnet är tjänligt att bada i.</span></p>\r\n<p><strong>Service vid badet</strong></p>\r\n<p><a href=\"/wps/portal?uri=gbglnk%3a20201219207511\" target=\"_self\">Toaletterna är öppna under badsäsongen.</a></p>\r\n<p><strong>Hundförbud på badet</strong></p>\r\n<p><span>Det är hundförbud på Askimsbadet mellan 1 maj och 15 september</span><span>.</span></p>\r\n<p>Från och med 30 juni får du passera Askimsbadet med kopplad hund.</p>"
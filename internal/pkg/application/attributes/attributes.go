@@ -0,0 +1,201 @@
+package attributes
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+)
+
+const (
+	KindList string = "list"
+	KindText string = "text"
+	// KindIgnore marks attribute values that are deliberately not published, e.g. because they are handled elsewhere
+	KindIgnore string = "ignore"
+)
+
+// AnyValue matches every value of an attribute that has no mapping of its own
+const AnyValue string = "*"
+
+// Mapping maps a ServiceGuiden attribute value to a value of an NGSI-LD property
+type Mapping struct {
+	Attribute   string
+	Value       string
+	Property    string
+	Kind        string
+	MappedValue string
+}
+
+type Mapper interface {
+	// Map returns properties for the mapped attribute values, and the attribute values that have no mapping
+	Map(attrs map[string][]string) ([]entities.EntityDecoratorFunc, []string)
+	// Properties returns the names of all properties that Map may return
+	Properties() []string
+}
+
+type mapper struct {
+	// attribute -> value -> mapping, with keys normalized by key()
+	mappings map[string]map[string]Mapping
+}
+
+func New(mappings []Mapping) Mapper {
+	m := &mapper{
+		mappings: map[string]map[string]Mapping{},
+	}
+
+	for _, mapping := range mappings {
+		attr := key(mapping.Attribute)
+		if _, ok := m.mappings[attr]; !ok {
+			m.mappings[attr] = map[string]Mapping{}
+		}
+		m.mappings[attr][key(mapping.Value)] = mapping
+	}
+
+	return m
+}
+
+// Load reads mappings from a semicolon separated file. A missing file results in a mapper without mappings.
+func Load(filePath string) (Mapper, error) {
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return New(nil), nil
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open file %s: %w", filePath, err)
+	}
+	defer f.Close()
+
+	mappings, err := load(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load mappings from file %s: %w", filePath, err)
+	}
+
+	return New(mappings), nil
+}
+
+func load(r io.Reader) ([]Mapping, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = ';'
+	reader.FieldsPerRecord = 5
+	reader.Comment = '#'
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	mappings := []Mapping{}
+
+	for idx, row := range rows {
+		if idx == 0 {
+			continue
+		}
+
+		m := Mapping{
+			Attribute:   strings.TrimSpace(row[0]),
+			Value:       strings.TrimSpace(row[1]),
+			Property:    strings.TrimSpace(row[2]),
+			Kind:        strings.TrimSpace(row[3]),
+			MappedValue: strings.TrimSpace(row[4]),
+		}
+
+		if m.Kind != KindList && m.Kind != KindText && m.Kind != KindIgnore {
+			return nil, fmt.Errorf("line %d: kind must be %q, %q or %q, got %q", idx+1, KindList, KindText, KindIgnore, m.Kind)
+		}
+
+		if m.Attribute == "" || m.Value == "" {
+			return nil, fmt.Errorf("line %d: attribute and value must not be empty", idx+1)
+		}
+
+		if m.Kind != KindIgnore && (m.Property == "" || m.MappedValue == "") {
+			return nil, fmt.Errorf("line %d: property and mapped_value must not be empty", idx+1)
+		}
+
+		mappings = append(mappings, m)
+	}
+
+	return mappings, nil
+}
+
+func (m mapper) Map(attrs map[string][]string) ([]entities.EntityDecoratorFunc, []string) {
+	values := map[string][]string{}
+	kinds := map[string]string{}
+	unmapped := []string{}
+
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		known := m.mappings[key(name)]
+
+		for _, v := range attrs[name] {
+			mapping, ok := known[key(v)]
+			if !ok {
+				mapping, ok = known[AnyValue]
+			}
+			if !ok {
+				unmapped = append(unmapped, fmt.Sprintf("%s: %s", name, v))
+				continue
+			}
+
+			if mapping.Kind == KindIgnore {
+				continue
+			}
+
+			kinds[mapping.Property] = mapping.Kind
+			if !contains(values[mapping.Property], mapping.MappedValue) {
+				values[mapping.Property] = append(values[mapping.Property], mapping.MappedValue)
+			}
+		}
+	}
+
+	props := []entities.EntityDecoratorFunc{}
+
+	for property, v := range values {
+		if kinds[property] == KindText {
+			props = append(props, decorators.Text(property, strings.Join(v, ", ")))
+		} else {
+			props = append(props, decorators.TextList(property, v))
+		}
+	}
+
+	return props, unmapped
+}
+
+func (m mapper) Properties() []string {
+	properties := []string{}
+
+	for _, values := range m.mappings {
+		for _, mapping := range values {
+			if mapping.Kind != KindIgnore && !contains(properties, mapping.Property) {
+				properties = append(properties, mapping.Property)
+			}
+		}
+	}
+
+	sort.Strings(properties)
+
+	return properties
+}
+
+func key(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package attributes
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/matryer/is"
+)
+
+func TestLoadMappingFile(t *testing.T) {
+	is := is.New(t)
+
+	f, err := os.Open("../../../../assets/config/attributes.csv")
+	is.NoErr(err)
+	defer f.Close()
+
+	mappings, err := load(f)
+	is.NoErr(err)
+	is.True(len(mappings) > 0)
+}
+
+func TestMap(t *testing.T) {
+	is := is.New(t)
+
+	m := New([]Mapping{
+		{Attribute: "Toalett", Value: "Toalett öppen under badsäsong", Property: "facilities", Kind: KindList, MappedValue: "toilets"},
+		{Attribute: "Service", Value: "Grillplats", Property: "facilities", Kind: KindList, MappedValue: "barbecue"},
+		{Attribute: "Service", Value: "Kiosk eller café", Property: "facilities", Kind: KindList, MappedValue: "kiosk"},
+		{Attribute: "Hund tillåtet", Value: "Nej", Property: "dogsAllowed", Kind: KindText, MappedValue: "no"},
+	})
+
+	props, unmapped := m.Map(map[string][]string{
+		"Inriktning":    {"Hav"},
+		"Toalett":       {"Toalett öppen under badsäsong"},
+		"Service":       {"Grillplats", "Kiosk eller café", "Glasskiosk"},
+		"Hund tillåtet": {"Nej"},
+	})
+
+	// values of attributes without any mapping are reported as well
+	is.Equal([]string{"Inriktning: Hav", "Service: Glasskiosk"}, unmapped)
+
+	fragment, _ := entities.NewFragment(props...)
+	b, _ := fragment.MarshalJSON()
+
+	var result struct {
+		Facilities struct {
+			Value []string `json:"value"`
+		} `json:"facilities"`
+		DogsAllowed struct {
+			Value string `json:"value"`
+		} `json:"dogsAllowed"`
+	}
+	is.NoErr(json.Unmarshal(b, &result))
+
+	is.Equal([]string{"barbecue", "kiosk", "toilets"}, result.Facilities.Value)
+	is.Equal("no", result.DogsAllowed.Value)
+}
+
+func TestLoadFailsOnInvalidKind(t *testing.T) {
+	is := is.New(t)
+
+	_, err := load(strings.NewReader("attribute;value;property;kind;mapped_value\nToalett;Ja;facilities;number;toilets\n"))
+	is.True(err != nil)
+}
+
+func TestMapIgnoresValues(t *testing.T) {
+	is := is.New(t)
+
+	mappings, err := load(strings.NewReader("attribute;value;property;kind;mapped_value\n# comments are skipped\nToalett;Ja;facilities;list;toilets\nToalett;Nej;;ignore;\nInriktning;*;;ignore;\n"))
+	is.NoErr(err)
+
+	m := New(mappings)
+	is.Equal([]string{"facilities"}, m.Properties())
+
+	props, unmapped := m.Map(map[string][]string{
+		"Inriktning": {"Hav", "Sjö"},
+		"Toalett":    {"Nej", "Kanske"},
+	})
+
+	is.Equal(0, len(props))
+	is.Equal([]string{"Toalett: Kanske"}, unmapped)
+}
+
+func TestLoadRequiresPropertyUnlessIgnored(t *testing.T) {
+	is := is.New(t)
+
+	_, err := load(strings.NewReader("attribute;value;property;kind;mapped_value\nToalett;Ja;;list;\n"))
+	is.True(err != nil)
+}
@@ -0,0 +1,136 @@
+package cip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/ratelimit"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/retry"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+)
+
+type BatchClient interface {
+	// Upsert creates or merges a batch of entities in a single request. An error is returned if the request
+	// as a whole failed, errors for individual entities are returned in the result.
+	Upsert(ctx context.Context, entities []types.Entity) (*BatchResult, error)
+}
+
+type BatchResult struct {
+	Succeeded []string
+	Failed    map[string]error
+}
+
+type batchClient struct {
+	baseURL    string
+	transport  http.RoundTripper
+	httpClient http.Client
+}
+
+// BatchRetryPolicy retries batch requests according to the policy
+func BatchRetryPolicy(policy retry.Policy) func(*batchClient) {
+	return func(c *batchClient) {
+		c.transport = retry.NewTransport(c.transport, policy)
+	}
+}
+
+// BatchRateLimit limits the rate of batch requests, including retries if the option is given before BatchRetryPolicy
+func BatchRateLimit(limiter *ratelimit.PerHost) func(*batchClient) {
+	return func(c *batchClient) {
+		c.transport = limiter.Transport(c.transport)
+	}
+}
+
+func NewBatchClient(brokerURL string, options ...func(*batchClient)) BatchClient {
+	c := &batchClient{
+		baseURL:   brokerURL,
+		transport: http.DefaultTransport,
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	c.httpClient = http.Client{
+		Transport: otelhttp.NewTransport(c.transport),
+	}
+
+	return c
+}
+
+var tracer = otel.Tracer("integration-cip-gbg-ms/cip")
+
+type batchOperationResult struct {
+	Success []string `json:"success"`
+	Errors  []struct {
+		EntityID string `json:"entityId"`
+		Error    struct {
+			Type   string `json:"type"`
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+		} `json:"error"`
+	} `json:"errors"`
+}
+
+func (c batchClient) Upsert(ctx context.Context, entities []types.Entity) (*BatchResult, error) {
+	var err error
+
+	ctx, span := tracer.Start(ctx, "integration-cip-gbg-ms/cip/upsert")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	body, err := json.Marshal(entities)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal entities: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/ngsi-ld/v1/entityOperations/upsert?options=update", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ld+json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send batch upsert: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	result := &BatchResult{
+		Succeeded: []string{},
+		Failed:    map[string]error{},
+	}
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusNoContent:
+		for _, e := range entities {
+			result.Succeeded = append(result.Succeeded, e.ID())
+		}
+		return result, nil
+	case http.StatusMultiStatus:
+		var bor batchOperationResult
+		if err = json.Unmarshal(respBody, &bor); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal batch operation result: %w", err)
+		}
+
+		result.Succeeded = append(result.Succeeded, bor.Success...)
+		for _, e := range bor.Errors {
+			result.Failed[e.EntityID] = fmt.Errorf("%s: %s (%s)", e.Error.Title, e.Error.Detail, e.Error.Type)
+		}
+		return result, nil
+	}
+
+	err = ngsierrors.NewErrorFromProblemReport(resp.StatusCode, resp.Header.Get("Content-Type"), respBody)
+	return nil, fmt.Errorf("batch upsert failed with status code %d, %w", resp.StatusCode, err)
+}
@@ -0,0 +1,63 @@
+package cip
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+	"github.com/matryer/is"
+)
+
+func TestUpsertReportsPerEntityErrors(t *testing.T) {
+	is := is.New(t)
+
+	var received []map[string]any
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.Equal("/ngsi-ld/v1/entityOperations/upsert", r.URL.Path)
+		is.Equal("update", r.URL.Query().Get("options"))
+
+		b, _ := io.ReadAll(r.Body)
+		is.NoErr(json.Unmarshal(b, &received))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write([]byte(`{"success":["urn:ngsi-ld:Beach:1"],"errors":[{"entityId":"urn:ngsi-ld:Beach:2","error":{"type":"https://uri.etsi.org/ngsi-ld/errors/BadRequestData","title":"Bad Request","detail":"invalid location"}}]}`))
+	}))
+	defer server.Close()
+
+	result, err := NewBatchClient(server.URL).Upsert(context.Background(), testEntities(2))
+	is.NoErr(err)
+
+	is.Equal(2, len(received))
+	is.Equal([]string{"urn:ngsi-ld:Beach:1"}, result.Succeeded)
+	is.True(result.Failed["urn:ngsi-ld:Beach:2"] != nil)
+}
+
+func TestUpsertFailsOnRequestError(t *testing.T) {
+	is := is.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotImplemented)
+	}))
+	defer server.Close()
+
+	_, err := NewBatchClient(server.URL).Upsert(context.Background(), testEntities(2))
+	is.True(err != nil)
+}
+
+func testEntities(count int) []types.Entity {
+	result := []types.Entity{}
+	for i := 1; i <= count; i++ {
+		e, _ := entities.New(fmt.Sprintf("urn:ngsi-ld:Beach:%d", i), "Beach", decorators.Name("beach"))
+		result = append(result, e)
+	}
+	return result
+}
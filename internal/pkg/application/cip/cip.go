@@ -2,15 +2,24 @@ package cip
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/url"
+	"strings"
 	"time"
 
+	"github.com/diwise/context-broker/pkg/datamodels/fiware"
 	"github.com/diwise/context-broker/pkg/ngsild/client"
 	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/geojson"
 	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
 	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+	"github.com/diwise/context-broker/pkg/ngsild/types/relationships"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/description"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/diff"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/hav"
 	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/serviceguiden"
 	"github.com/diwise/service-chassis/pkg/infrastructure/env"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
@@ -22,51 +31,153 @@ var dataProvider string
 var source string
 
 func init() {
-	havOchVattenProfileUrl = env.GetVariableOrDefault(context.Background(), "HAV_OCH_VATTEN_PROFILE_URL", "https://badplatsen.havochvatten.se/badplatsen/api/testlocationprofile")
+	havOchVattenProfileUrl = env.GetVariableOrDefault(context.Background(), "HAV_OCH_VATTEN_PROFILE_URL", hav.DefaultProfileURL)
 	seeAlsoUrl = env.GetVariableOrDefault(context.Background(), "SEE_ALSO_URL", "https://goteborg.se/wps/portal/start/uppleva-och-gora/idrott-motion-och-friluftsliv/simma-och-bada/badplatser/hitta-badplatser-utomhusbad/?id=")
 	dataProvider = env.GetVariableOrDefault(context.Background(), "DATA_PROVIDER", "ServiceGuiden")
 	source = env.GetVariableOrDefault(context.Background(), "SOURCE", "se:goteborg:serviceguiden:businessid:")
 }
 
-func MergeOrCreate(ctx context.Context, cbClient client.ContextBrokerClient, id string, typeName string, properties []entities.EntityDecoratorFunc) error {
+// Descriptions decide which representations of descriptions are published. The first format is published as
+// description and every other format as description followed by the format name, e.g. descriptionText.
+// Descriptions are not published if there are no formats.
+type Descriptions struct {
+	Formats []description.Format
+	// BaseURL is used to resolve relative links in descriptions
+	BaseURL *url.URL
+}
+
+// Props returns a property for each format of a description
+func (d Descriptions) Props(desc string) []entities.EntityDecoratorFunc {
+	props := []entities.EntityDecoratorFunc{}
+
+	for idx, format := range d.Formats {
+		name := "description"
+		if idx > 0 {
+			name = descriptionAttribute(format)
+		}
+		props = append(props, decorators.Text(name, description.Convert(desc, format, d.BaseURL)))
+	}
+
+	return props
+}
+
+// DescriptionAttributes returns the names of the attributes that a description may be published as, in any format
+func DescriptionAttributes() []string {
+	names := []string{"description"}
+	for _, format := range description.Formats {
+		names = append(names, descriptionAttribute(format))
+	}
+	return names
+}
+
+func descriptionAttribute(format description.Format) string {
+	return "description" + strings.ToUpper(string(format[:1])) + string(format[1:])
+}
+
+// MergeOrCreate merges the properties into an existing entity, or creates the entity if it does not exist,
+// and reports whether the entity was created
+func MergeOrCreate(ctx context.Context, cbClient client.ContextBrokerClient, id string, typeName string, properties []entities.EntityDecoratorFunc) (created bool, err error) {
 	log := logging.GetFromContext(ctx)
 
 	headers := map[string][]string{"Content-Type": {"application/ld+json"}}
 
 	fragment, err := entities.NewFragment(properties...)
 	if err != nil {
-		return fmt.Errorf("failed to create new fragment for entity %s, %w", id, err)
+		return false, fmt.Errorf("failed to create new fragment for entity %s, %w", id, err)
 	}
 
 	_, err = cbClient.MergeEntity(ctx, id, fragment, headers)
 	if err != nil {
 		if !errors.Is(err, ngsierrors.ErrNotFound) {
-			return fmt.Errorf("failed to merge entity %s, %w", id, err)
+			return false, fmt.Errorf("failed to merge entity %s, %w", id, err)
 		}
 
-		properties = append(properties, entities.DefaultContext())
+		properties = append(properties, entities.DefaultContext(), DateCreated())
 
 		entity, err := entities.New(id, typeName, properties...)
 		if err != nil {
-			return fmt.Errorf("failed to create new entity props for entity %s, %w", id, err)
+			return false, fmt.Errorf("failed to create new entity props for entity %s, %w", id, err)
+		}
+
+		// there is nothing to delete from an entity that does not exist
+		if e, ok := entity.(*entities.EntityImpl); ok {
+			e.RemoveAttribute(func(attributeType, attributeName string, contents any) bool {
+				_, isNull := contents.(ngsiNull)
+				return isNull
+			})
 		}
 
 		_, err = cbClient.CreateEntity(ctx, entity, headers)
 		if err != nil {
-			return fmt.Errorf("failed to create entity %s, %w", id, err)
+			return false, fmt.Errorf("failed to create entity %s, %w", id, err)
 		}
 
 		log.Debug("create entity", slog.String("entity_id", id))
 
-		return nil
+		return true, nil
 	}
 
 	log.Debug("merge entity", slog.String("entity_id", id))
 
-	return nil
+	return false, nil
 }
 
-func NewBeachProps(badplats serviceguiden.Beach, nutsCode string) []entities.EntityDecoratorFunc {
+// Diff compares the properties with the entity currently in the context broker without changing anything.
+// If the entity does not exist, created is true and every property is reported as added.
+func Diff(ctx context.Context, cbClient client.ContextBrokerClient, id string, properties []entities.EntityDecoratorFunc) (created bool, changes []diff.Change, err error) {
+	// the attributes are compacted with the same context as the fragment, so that they can be compared
+	headers := map[string][]string{
+		"Accept": {"application/ld+json"},
+		"Link":   {entities.LinkHeader},
+	}
+
+	fragment, err := entities.NewFragment(properties...)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to create new fragment for entity %s, %w", id, err)
+	}
+
+	current, err := cbClient.RetrieveEntity(ctx, id, headers)
+	if err != nil {
+		if !errors.Is(err, ngsierrors.ErrNotFound) {
+			return false, nil, fmt.Errorf("failed to retrieve entity %s, %w", id, err)
+		}
+		created = true
+	}
+
+	changes, err = diff.Compare(current, fragment)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to compare entity %s, %w", id, err)
+	}
+
+	return created, changes, nil
+}
+
+// EntityExists reports whether an entity with the given id can be retrieved from the context broker
+func EntityExists(ctx context.Context, cbClient client.ContextBrokerClient, id string) (bool, error) {
+	headers := map[string][]string{"Accept": {"application/ld+json"}}
+
+	_, err := cbClient.RetrieveEntity(ctx, id, headers)
+	if err != nil {
+		if errors.Is(err, ngsierrors.ErrNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to retrieve entity %s, %w", id, err)
+	}
+
+	return true, nil
+}
+
+// DeviceID returns the NGSI-LD id of a Device, adding the urn prefix if needed
+func DeviceID(deviceID string) string {
+	if strings.HasPrefix(deviceID, fiware.DeviceIDPrefix) {
+		return deviceID
+	}
+	return fiware.DeviceIDPrefix + deviceID
+}
+
+// NewBeachProps creates the properties of a Beach entity. The refDevice relationship is only added
+// when a deviceID is given, so callers are responsible for making sure that the Device exists.
+func NewBeachProps(badplats serviceguiden.Beach, nutsCode, deviceID string, shape [][][][]float64) []entities.EntityDecoratorFunc {
 	props := []entities.EntityDecoratorFunc{}
 
 	lat := badplats.Position().Latitude
@@ -79,26 +190,123 @@ func NewBeachProps(badplats serviceguiden.Beach, nutsCode string) []entities.Ent
 	source := fmt.Sprintf("%s%d", source, badplats.BusinessId())
 
 	props = append(props,
-		decorators.LocationMP([][][][]float64{{{
-			{lon, lat},
-			{lon, lat + 0.0001},
-			{lon + 0.0001, lat + 0.0001},
-			{lon, lat},
-		}}}),
+		decorators.LocationMP(shape),
+		entities.P("position", geojson.CreateGeoJSONPropertyFromWGS84(lon, lat)),
 		entities.DefaultContext(),
 		decorators.Name(badplats.Name()),
-		decorators.Text("description", badplats.Description()),
 		decorators.Text("areaServed", badplats.AreaServed()),
 		decorators.Text("dataProvider", dataProvider),
 		decorators.Text("source", source),
-		decorators.DateCreated(time.Now().UTC().Format(time.RFC3339)),
+		DateModified(badplats.LastModified()),
 		decorators.TextList("beachType", badplats.BeachTypes()),
 		decorators.TextList("seeAlso", seeAlso),
 	)
 
+	if deviceID != "" {
+		props = append(props, decorators.RefDevice(DeviceID(deviceID)))
+	}
+
 	return props
 }
 
+// NewSiteProps creates the properties of an entity for any other kind of ServiceGuiden site. The site
+// is located by its point position and categories are only added when given.
+func NewSiteProps(site serviceguiden.Site, category []string) []entities.EntityDecoratorFunc {
+	seeAlso := filter([]string{site.WebSite(), site.AccessibilityUrl()}, func(s string) bool {
+		return s != ""
+	})
+
+	source := fmt.Sprintf("%s%d", source, site.BusinessId())
+
+	props := []entities.EntityDecoratorFunc{
+		decorators.Location(site.Position().Latitude, site.Position().Longitude),
+		entities.DefaultContext(),
+		decorators.Name(site.Name()),
+		decorators.Text("areaServed", site.AreaServed()),
+		decorators.Text("dataProvider", dataProvider),
+		decorators.Text("source", source),
+		DateModified(site.LastModified()),
+		decorators.TextList("seeAlso", seeAlso),
+	}
+
+	if len(category) > 0 {
+		props = append(props, decorators.TextList("category", category))
+	}
+
+	return props
+}
+
+// WaterQualityObservedID returns a deterministic id for a sample taken at a bathing site
+func WaterQualityObservedID(nutsCode string, sample hav.Sample) string {
+	return fmt.Sprintf("%s%s:%s", fiware.WaterQualityObservedIDPrefix, nutsCode, sample.Time().Format("20060102T150405Z"))
+}
+
+// NewWaterQualityObservedProps creates the properties of a WaterQualityObserved entity for a sample,
+// located at and related to the beach where it was taken
+func NewWaterQualityObservedProps(beachID string, position serviceguiden.Position, nutsCode string, sample hav.Sample) []entities.EntityDecoratorFunc {
+	props := []entities.EntityDecoratorFunc{
+		entities.DefaultContext(),
+		decorators.Location(position.Latitude, position.Longitude),
+		decorators.DateObserved(sample.Time().Format(time.RFC3339)),
+		entities.R("refPointOfInterest", relationships.NewSingleObjectRelationship(beachID)),
+		decorators.Text("dataProvider", dataProvider),
+		decorators.Text("source", getNutsCodeUrl(nutsCode)),
+	}
+
+	if sample.WaterTemp != nil {
+		props = append(props, decorators.Temperature(*sample.WaterTemp))
+	}
+
+	if sample.EscherichiaColiCount != nil {
+		props = append(props, decorators.Number("escherichiaColi", *sample.EscherichiaColiCount))
+		if sample.EscherichiaColiPrefix != "" {
+			props = append(props, decorators.Text("escherichiaColiPrefix", sample.EscherichiaColiPrefix))
+		}
+	}
+
+	if sample.IntestinalEnterococciCount != nil {
+		props = append(props, decorators.Number("intestinalEnterococci", *sample.IntestinalEnterococciCount))
+		if sample.IntestinalEnterococciPrefix != "" {
+			props = append(props, decorators.Text("intestinalEnterococciPrefix", sample.IntestinalEnterococciPrefix))
+		}
+	}
+
+	if sample.SampleAssessIdText != "" {
+		props = append(props, decorators.Text("assessment", sample.SampleAssessIdText))
+	}
+
+	return props
+}
+
+// DeleteAttribute deletes an attribute, such as a property that is no longer published, when an existing entity is merged
+func DeleteAttribute(name string) entities.EntityDecoratorFunc {
+	return entities.P(name, ngsiNull{})
+}
+
+// ngsiNull is a property that is marshalled as the NGSI-LD null value
+type ngsiNull struct{}
+
+func (ngsiNull) Type() string { return "Property" }
+func (ngsiNull) Value() any   { return diff.Null }
+
+func (ngsiNull) MarshalJSON() ([]byte, error) {
+	return json.Marshal(diff.Null)
+}
+
+// DateCreated sets dateCreated to the current time and should only be added when an entity is created
+func DateCreated() entities.EntityDecoratorFunc {
+	return decorators.DateCreated(time.Now().UTC().Format(time.RFC3339))
+}
+
+// DateModified sets dateModified to the time the source was modified, or to the current time if that is unknown.
+// It is not part of the content hash, so unchanged sites are still skipped.
+func DateModified(sourceModified time.Time) entities.EntityDecoratorFunc {
+	if sourceModified.IsZero() {
+		sourceModified = time.Now()
+	}
+	return decorators.DateModified(sourceModified.UTC().Format(time.RFC3339))
+}
+
 func getSeeAlso(badplats serviceguiden.Beach) string {
 	return fmt.Sprintf("%s%d", seeAlsoUrl, badplats.BusinessId())
 }
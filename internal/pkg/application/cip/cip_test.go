@@ -0,0 +1,220 @@
+package cip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+	test "github.com/diwise/context-broker/pkg/test"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/description"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/serviceguiden"
+	"github.com/matryer/is"
+)
+
+func TestNewBeachPropsWithDevice(t *testing.T) {
+	is := is.New(t)
+
+	props := NewBeachProps(testBeach(), "SE0A21480000000532", "temp-sensor-01", testShape())
+	m := toMap(t, props)
+
+	refDevice, ok := m["refDevice"].(map[string]any)
+	is.True(ok)
+	is.Equal("urn:ngsi-ld:Device:temp-sensor-01", refDevice["object"])
+}
+
+func TestNewBeachPropsWithoutDevice(t *testing.T) {
+	is := is.New(t)
+
+	props := NewBeachProps(testBeach(), "", "", testShape())
+	m := toMap(t, props)
+
+	_, ok := m["refDevice"]
+	is.True(!ok)
+}
+
+func TestNewBeachPropsLocationAndPosition(t *testing.T) {
+	is := is.New(t)
+
+	props := NewBeachProps(testBeach(), "", "", testShape())
+	m := toMap(t, props)
+
+	location := m["location"].(map[string]any)["value"].(map[string]any)
+	is.Equal("MultiPolygon", location["type"])
+
+	position := m["position"].(map[string]any)
+	is.Equal("GeoProperty", position["type"])
+	is.Equal("Point", position["value"].(map[string]any)["type"])
+}
+
+func TestDescriptionsProps(t *testing.T) {
+	is := is.New(t)
+
+	base, _ := url.Parse("https://goteborg.se")
+	descriptions := Descriptions{Formats: []description.Format{description.Text, description.Raw, description.HTML}, BaseURL: base}
+
+	desc := "<p><span>Badplats med brygga.</span></p>\r\n<p><a href=\"/wps/portal\">Läs mer</a></p>"
+
+	m := toMap(t, descriptions.Props(desc))
+
+	is.Equal("Badplats med brygga.\n\nLäs mer", m["description"].(map[string]any)["value"])
+	is.Equal(desc, m["descriptionRaw"].(map[string]any)["value"])
+	is.True(strings.Contains(m["descriptionHtml"].(map[string]any)["value"].(string), `href="https://goteborg.se/wps/portal"`))
+
+	_, ok := m["descriptionText"]
+	is.True(!ok)
+
+	is.Equal(0, len(Descriptions{}.Props(desc)))
+}
+
+func TestDiffCompactsAttributes(t *testing.T) {
+	is := is.New(t)
+
+	cbClient := &test.ContextBrokerClientMock{
+		RetrieveEntityFunc: func(ctx context.Context, entityID string, headers map[string][]string) (types.Entity, error) {
+			if len(headers["Link"]) != 1 || headers["Link"][0] != entities.LinkHeader {
+				return nil, errors.New("attributes would not be compacted")
+			}
+			return entities.New(entityID, "Beach", decorators.Name("Askimsbadet"))
+		},
+	}
+
+	created, changes, err := Diff(context.Background(), cbClient, "urn:ngsi-ld:Beach:1", []entities.EntityDecoratorFunc{decorators.Name("Askimsbadet")})
+	is.NoErr(err)
+	is.True(!created)
+	is.Equal(0, len(changes))
+}
+
+func TestEntityExists(t *testing.T) {
+	is := is.New(t)
+
+	cbClient := &test.ContextBrokerClientMock{
+		RetrieveEntityFunc: func(ctx context.Context, entityID string, headers map[string][]string) (types.Entity, error) {
+			if entityID == "urn:ngsi-ld:Device:found" {
+				return entities.New(entityID, "Device")
+			}
+			return nil, ngsierrors.NewNotFoundError("not found")
+		},
+	}
+
+	exists, err := EntityExists(context.Background(), cbClient, "urn:ngsi-ld:Device:found")
+	is.NoErr(err)
+	is.True(exists)
+
+	exists, err = EntityExists(context.Background(), cbClient, "urn:ngsi-ld:Device:missing")
+	is.NoErr(err)
+	is.True(!exists)
+}
+
+func testBeach() serviceguiden.Content {
+	return serviceguiden.Content{
+		ID_:         "61e0a244cfc4d247cca95f4e",
+		Name_:       "Askimsbadet",
+		BusinessID_: 3683,
+		Position_: serviceguiden.Position{
+			Latitude:  57.62595719307582,
+			Longitude: 11.92624964921406,
+		},
+	}
+}
+
+func testShape() [][][][]float64 {
+	return [][][][]float64{{{
+		{11.925, 57.625}, {11.927, 57.625}, {11.927, 57.627}, {11.925, 57.625},
+	}}}
+}
+
+func toMap(t *testing.T, props []entities.EntityDecoratorFunc) map[string]any {
+	fragment, err := entities.NewFragment(props...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := fragment.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := map[string]any{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func TestContentHashIgnoresVolatileProperties(t *testing.T) {
+	is := is.New(t)
+
+	props := NewBeachProps(testBeach(), "SE0A21480000000532", "", testShape())
+	first, err := ContentHash(props)
+	is.NoErr(err)
+
+	props = append(NewBeachProps(testBeach(), "SE0A21480000000532", "", testShape()),
+		decorators.DateCreated("2000-01-01T00:00:00Z"),
+		WithContentHash(first),
+	)
+	second, err := ContentHash(props)
+	is.NoErr(err)
+	is.Equal(first, second)
+
+	changed, err := ContentHash(NewBeachProps(testBeach(), "SE0A21480000004452", "", testShape()))
+	is.NoErr(err)
+	is.True(first != changed)
+}
+
+func TestDateCreatedIsOnlySetOnCreate(t *testing.T) {
+	is := is.New(t)
+
+	var merged, created []byte
+
+	cbClient := &test.ContextBrokerClientMock{
+		MergeEntityFunc: func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+			merged, _ = fragment.MarshalJSON()
+			return nil, ngsierrors.NewNotFoundError("not found")
+		},
+		CreateEntityFunc: func(ctx context.Context, entity types.Entity, headers map[string][]string) (*ngsild.CreateEntityResult, error) {
+			created, _ = entity.MarshalJSON()
+			return ngsild.NewCreateEntityResult(""), nil
+		},
+	}
+
+	beach := testBeach()
+	beach.EventLogs = []serviceguiden.EventLog{{EventAction: "UPDATED", EventDateTime: "2022-04-07 10:43:14"}}
+
+	props := append(NewBeachProps(beach, "", "", testShape()), DeleteAttribute("refDevice"))
+
+	wasCreated, err := MergeOrCreate(context.Background(), cbClient, "urn:ngsi-ld:Beach:1", "Beach", props)
+	is.NoErr(err)
+	is.True(wasCreated)
+
+	is.True(!strings.Contains(string(merged), "dateCreated"))
+	is.True(strings.Contains(string(merged), "dateModified"))
+	is.True(strings.Contains(string(merged), `"refDevice":"urn:ngsi-ld:null"`))
+	is.True(strings.Contains(string(created), "dateCreated"))
+	is.True(!strings.Contains(string(created), "refDevice")) // attributes are only deleted from existing entities
+}
+
+func TestDateModifiedFallsBackToNow(t *testing.T) {
+	is := is.New(t)
+
+	props := NewBeachProps(testBeach(), "", "", testShape())
+	m := toMap(t, props)
+	_, ok := m["dateModified"]
+	is.True(ok)
+
+	hash, _ := ContentHash(props)
+	later, _ := ContentHash(append(props, DateModified(time.Now().Add(time.Hour))))
+	is.Equal(hash, later) // dateModified does not make an unchanged site look changed
+
+	m = toMap(t, []entities.EntityDecoratorFunc{DateModified(time.Date(2022, 4, 7, 8, 43, 14, 0, time.UTC))})
+	is.Equal("2022-04-07T08:43:14Z", m["dateModified"].(map[string]any)["value"].(map[string]any)["@value"])
+}
@@ -0,0 +1,57 @@
+package cip
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+	"github.com/diwise/context-broker/pkg/ngsild/types/properties"
+)
+
+const ContentHashProperty string = "contentHash"
+
+// properties that change without the content changing and thus are excluded from the content hash
+var volatileProperties = map[string]bool{
+	properties.DateCreated:  true,
+	properties.DateModified: true,
+	ContentHashProperty:     true,
+}
+
+// ContentHash returns a stable hash of the attributes that the given properties produce
+func ContentHash(props []entities.EntityDecoratorFunc) (string, error) {
+	fragment, err := entities.NewFragment(props...)
+	if err != nil {
+		return "", err
+	}
+
+	attributes := map[string]any{}
+
+	fragment.ForEachAttribute(func(attributeType, attributeName string, contents any) {
+		if !volatileProperties[attributeName] {
+			attributes[attributeName] = contents
+		}
+	})
+
+	// maps are marshalled with sorted keys, so the json encoding is stable
+	b, err := json.Marshal(attributes)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal attributes, %w", err)
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// WithContentHash adds the content hash as a property so that it can be compared in later runs
+func WithContentHash(hash string) entities.EntityDecoratorFunc {
+	return decorators.Text(ContentHashProperty, hash)
+}
+
+// StoredContentHash returns the content hash stored on an existing entity, or an empty string
+func StoredContentHash(e types.Entity) string {
+	return textValue(e, ContentHashProperty)
+}
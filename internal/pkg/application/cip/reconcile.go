@@ -0,0 +1,223 @@
+package cip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/report"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+)
+
+type ReconcileMode string
+
+const (
+	ReconcileOff    ReconcileMode = "off"
+	ReconcileDelete ReconcileMode = "delete"
+	ReconcileRetire ReconcileMode = "retire"
+)
+
+const (
+	StatusActive  string = "active"
+	StatusRetired string = "retired"
+)
+
+var ErrReconcileLimitExceeded = errors.New("too many entities would be removed")
+
+const queryLimit int = 100
+
+func ParseReconcileMode(mode string) (ReconcileMode, error) {
+	switch m := ReconcileMode(mode); m {
+	case ReconcileOff, ReconcileDelete, ReconcileRetire:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown reconcile mode %q", mode)
+}
+
+type ReconcileOptions struct {
+	Mode ReconcileMode
+	// MaxFraction is the largest share of our existing entities that may be removed in a single run
+	MaxFraction float64
+	// DryRun reports what would be removed or reactivated without changing anything
+	DryRun bool
+}
+
+// ListEntities returns all entities of a type that have been published by this integration
+func ListEntities(ctx context.Context, cbClient client.ContextBrokerClient, typeName string) ([]types.Entity, error) {
+	headers := map[string][]string{
+		"Accept": {"application/ld+json"},
+		"Link":   {entities.LinkHeader},
+	}
+
+	result := []types.Entity{}
+
+	for offset := 0; ; offset += queryLimit {
+		params := url.Values{}
+		params.Set("type", typeName)
+		params.Set("q", fmt.Sprintf("dataProvider==%q", dataProvider))
+		params.Set("limit", fmt.Sprintf("%d", queryLimit))
+		params.Set("offset", fmt.Sprintf("%d", offset))
+
+		qer, err := cbClient.QueryEntities(ctx, []string{typeName}, nil, params.Encode(), headers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query entities of type %s, %w", typeName, err)
+		}
+
+		count := 0
+		for e := range qer.Found {
+			if e == nil {
+				break
+			}
+			result = append(result, e)
+			count++
+		}
+
+		if count < queryLimit {
+			return result, nil
+		}
+	}
+}
+
+// Reconcile removes or retires existing entities of a type that are no longer present upstream, i.e. not in currentIDs.
+// Retired entities that are present upstream again are reactivated. Existing entities should be listed with ListEntities.
+func Reconcile(ctx context.Context, cbClient client.ContextBrokerClient, typeName string, existing []types.Entity, currentIDs map[string]bool, opts ReconcileOptions, rpt *report.Report) error {
+	var err error
+
+	log := logging.GetFromContext(ctx)
+
+	if opts.Mode == ReconcileOff || len(existing) == 0 {
+		return nil
+	}
+
+	if len(currentIDs) == 0 {
+		return fmt.Errorf("refusing to reconcile %s entities against an empty upstream result, %w", typeName, ErrReconcileLimitExceeded)
+	}
+
+	stale := []string{}
+	reactivate := []string{}
+
+	for _, e := range existing {
+		retired := Status(e) == StatusRetired
+
+		if currentIDs[e.ID()] {
+			if retired {
+				reactivate = append(reactivate, e.ID())
+			}
+			continue
+		}
+
+		if !retired || opts.Mode == ReconcileDelete {
+			stale = append(stale, e.ID())
+		}
+	}
+
+	if float64(len(stale)) > opts.MaxFraction*float64(len(existing)) {
+		return fmt.Errorf("%d of %d %s entities are missing upstream, max fraction is %.2f, %w", len(stale), len(existing), typeName, opts.MaxFraction, ErrReconcileLimitExceeded)
+	}
+
+	errs := []error{}
+
+	if opts.DryRun {
+		for _, id := range stale {
+			entry := rpt.Entity(id, "")
+			entry.Type = typeName
+			entry.Outcome = report.Retired
+			if opts.Mode == ReconcileDelete {
+				entry.Outcome = report.Deleted
+			}
+		}
+		for _, id := range reactivate {
+			entry := rpt.Entity(id, "")
+			entry.Type = typeName
+			entry.Outcome = report.Reactivated
+		}
+		return nil
+	}
+
+	for _, id := range stale {
+		entry := rpt.Entity(id, "")
+		entry.Type = typeName
+
+		if opts.Mode == ReconcileDelete {
+			_, err = cbClient.DeleteEntity(ctx, id)
+			if err == nil {
+				entry.Outcome = report.Deleted
+			}
+		} else {
+			err = setStatus(ctx, cbClient, id, StatusRetired)
+			if err == nil {
+				entry.Outcome = report.Retired
+			}
+		}
+
+		if err != nil {
+			err = fmt.Errorf("failed to %s entity %s, %w", opts.Mode, id, err)
+			entry.Fail(err)
+			errs = append(errs, err)
+			continue
+		}
+
+		log.Info("entity no longer present upstream", slog.String("entity_id", id), slog.String("outcome", entry.Outcome))
+	}
+
+	for _, id := range reactivate {
+		entry := rpt.Entity(id, "")
+		entry.Type = typeName
+
+		err = setStatus(ctx, cbClient, id, StatusActive)
+		if err != nil {
+			err = fmt.Errorf("failed to reactivate entity %s, %w", id, err)
+			entry.Fail(err)
+			errs = append(errs, err)
+			continue
+		}
+
+		entry.Outcome = report.Reactivated
+		log.Info("retired entity present upstream again", slog.String("entity_id", id))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Status returns the value of the status property of an entity, or an empty string
+func Status(e types.Entity) string {
+	return textValue(e, "status")
+}
+
+func textValue(e types.Entity, name string) string {
+	value := ""
+
+	e.ForEachAttribute(func(attributeType, attributeName string, contents any) {
+		if attributeName != name {
+			return
+		}
+		if p, ok := contents.(types.Property); ok {
+			value, _ = p.Value().(string)
+		}
+	})
+
+	return value
+}
+
+func setStatus(ctx context.Context, cbClient client.ContextBrokerClient, id, status string) error {
+	headers := map[string][]string{"Content-Type": {"application/ld+json"}}
+
+	fragment, err := entities.NewFragment(
+		decorators.Status(status),
+		decorators.DateModified(time.Now().UTC().Format(time.RFC3339)),
+		entities.DefaultContext(),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = cbClient.MergeEntity(ctx, id, fragment, headers)
+	return err
+}
@@ -0,0 +1,132 @@
+package cip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+	test "github.com/diwise/context-broker/pkg/test"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/report"
+	"github.com/matryer/is"
+)
+
+func TestReconcileRetiresStaleEntities(t *testing.T) {
+	is := is.New(t)
+
+	cbClient := newReconcileMock(beaches(10), map[string]string{"urn:ngsi-ld:Beach:9": StatusRetired})
+	current := currentIDs(0, 8)
+	current["urn:ngsi-ld:Beach:9"] = true
+
+	rpt := report.New(false)
+	err := Reconcile(context.Background(), cbClient, "Beach", listEntities(t, cbClient), current, ReconcileOptions{Mode: ReconcileRetire, MaxFraction: 0.2}, rpt)
+	is.NoErr(err)
+
+	is.Equal(0, len(cbClient.DeleteEntityCalls()))
+	is.Equal(2, len(cbClient.MergeEntityCalls()))
+	is.Equal("urn:ngsi-ld:Beach:8", cbClient.MergeEntityCalls()[0].EntityID)
+	is.Equal(1, rpt.Count(report.Retired))
+	is.Equal(1, rpt.Count(report.Reactivated))
+}
+
+func TestReconcileDeletesStaleEntities(t *testing.T) {
+	is := is.New(t)
+
+	cbClient := newReconcileMock(beaches(10), nil)
+
+	rpt := report.New(false)
+	err := Reconcile(context.Background(), cbClient, "Beach", listEntities(t, cbClient), currentIDs(0, 9), ReconcileOptions{Mode: ReconcileDelete, MaxFraction: 0.2}, rpt)
+	is.NoErr(err)
+
+	is.Equal(1, len(cbClient.DeleteEntityCalls()))
+	is.Equal("urn:ngsi-ld:Beach:9", cbClient.DeleteEntityCalls()[0].EntityID)
+	is.Equal(1, rpt.Count(report.Deleted))
+}
+
+func TestReconcileRefusesToRemoveTooMany(t *testing.T) {
+	is := is.New(t)
+
+	cbClient := newReconcileMock(beaches(10), nil)
+
+	err := Reconcile(context.Background(), cbClient, "Beach", listEntities(t, cbClient), currentIDs(0, 5), ReconcileOptions{Mode: ReconcileDelete, MaxFraction: 0.2}, report.New(false))
+	is.True(errors.Is(err, ErrReconcileLimitExceeded))
+	is.Equal(0, len(cbClient.DeleteEntityCalls()))
+}
+
+func TestReconcileRefusesEmptyUpstream(t *testing.T) {
+	is := is.New(t)
+
+	cbClient := newReconcileMock(beaches(10), nil)
+
+	err := Reconcile(context.Background(), cbClient, "Beach", listEntities(t, cbClient), map[string]bool{}, ReconcileOptions{Mode: ReconcileDelete, MaxFraction: 1}, report.New(false))
+	is.True(errors.Is(err, ErrReconcileLimitExceeded))
+	is.Equal(0, len(cbClient.DeleteEntityCalls()))
+}
+
+func listEntities(t *testing.T, cbClient *test.ContextBrokerClientMock) []types.Entity {
+	existing, err := ListEntities(context.Background(), cbClient, "Beach")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return existing
+}
+
+func beaches(count int) []string {
+	ids := []string{}
+	for i := 0; i < count; i++ {
+		ids = append(ids, fmt.Sprintf("urn:ngsi-ld:Beach:%d", i))
+	}
+	return ids
+}
+
+func currentIDs(from, to int) map[string]bool {
+	ids := map[string]bool{}
+	for _, id := range beaches(to)[from:] {
+		ids[id] = true
+	}
+	return ids
+}
+
+func newReconcileMock(ids []string, status map[string]string) *test.ContextBrokerClientMock {
+	return &test.ContextBrokerClientMock{
+		QueryEntitiesFunc: func(ctx context.Context, entityTypes, entityAttributes []string, query string, headers map[string][]string) (*ngsild.QueryEntitiesResult, error) {
+			qer := ngsild.NewQueryEntitiesResult()
+			go func() {
+				for _, id := range ids {
+					props := []entities.EntityDecoratorFunc{decorators.Text("dataProvider", dataProvider)}
+					if s, ok := status[id]; ok {
+						props = append(props, decorators.Status(s))
+					}
+					e, _ := entities.New(id, "Beach", props...)
+					qer.Found <- e
+				}
+				qer.Found <- nil
+			}()
+			return qer, nil
+		},
+		MergeEntityFunc: func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+			return &ngsild.MergeEntityResult{}, nil
+		},
+		DeleteEntityFunc: func(ctx context.Context, entityID string) (*ngsild.DeleteEntityResult, error) {
+			return ngsild.NewDeleteEntityResult(), nil
+		},
+	}
+}
+
+func TestReconcileDryRunDoesNotWrite(t *testing.T) {
+	is := is.New(t)
+
+	cbClient := newReconcileMock(beaches(10), nil)
+
+	rpt := report.New(true)
+	err := Reconcile(context.Background(), cbClient, "Beach", listEntities(t, cbClient), currentIDs(0, 9), ReconcileOptions{Mode: ReconcileDelete, MaxFraction: 0.2, DryRun: true}, rpt)
+	is.NoErr(err)
+
+	is.Equal(0, len(cbClient.DeleteEntityCalls()))
+	is.Equal(0, len(cbClient.MergeEntityCalls()))
+	is.Equal(1, rpt.Count(report.Deleted))
+}
@@ -0,0 +1,226 @@
+package compare
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/diff"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/geometry"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/serviceguiden"
+)
+
+type Status string
+
+const (
+	Added    Status = "added"
+	Removed  Status = "removed"
+	Deleted  Status = "deleted"
+	Restored Status = "restored"
+	Changed  Status = "changed"
+)
+
+// statusOrder decides the order in which sites are listed, the most significant changes first
+var statusOrder = map[Status]int{Removed: 0, Deleted: 1, Added: 2, Restored: 3, Changed: 4}
+
+// Options decides which sites are compared and which changes are significant
+type Options struct {
+	// ServiceTypes limits the comparison to sites with any of the service types, all sites are compared if empty
+	ServiceTypes []string
+	// MinDistance is the distance in metres that a site must move to be reported as moved
+	MinDistance float64
+}
+
+type Move struct {
+	From     serviceguiden.Position `json:"from"`
+	To       serviceguiden.Position `json:"to"`
+	Distance float64                `json:"distance"`
+}
+
+// Site is a site that differs between two versions of ServiceGuiden
+type Site struct {
+	ID      string        `json:"id"`
+	Name    string        `json:"name"`
+	Status  Status        `json:"status"`
+	Moved   *Move         `json:"moved,omitempty"`
+	Changes []diff.Change `json:"changes,omitempty"`
+}
+
+// Sites returns the sites that were added, removed, deleted, restored or changed between before and after.
+// Sites that are flagged as deleted in both versions are ignored.
+func Sites(before, after []serviceguiden.Content, opts Options) []Site {
+	old := map[string]serviceguiden.Content{}
+	for _, c := range before {
+		if hasAnyServiceType(c, opts.ServiceTypes) {
+			old[c.ID()] = c
+		}
+	}
+
+	sites := []Site{}
+	seen := map[string]bool{}
+
+	for _, next := range after {
+		if !hasAnyServiceType(next, opts.ServiceTypes) {
+			continue
+		}
+
+		seen[next.ID()] = true
+
+		prev, ok := old[next.ID()]
+		if !ok {
+			if !next.Deleted {
+				sites = append(sites, Site{ID: next.ID(), Name: next.Name(), Status: Added})
+			}
+			continue
+		}
+
+		if prev.Deleted && next.Deleted {
+			continue
+		}
+
+		s := Site{ID: next.ID(), Name: next.Name(), Status: Changed, Changes: changes(prev, next)}
+
+		distance := geometry.Distance(prev.Position().Latitude, prev.Position().Longitude, next.Position().Latitude, next.Position().Longitude)
+		if distance > opts.MinDistance {
+			s.Moved = &Move{From: prev.Position(), To: next.Position(), Distance: distance}
+		}
+
+		if next.Deleted {
+			s.Status = Deleted
+		} else if prev.Deleted {
+			s.Status = Restored
+		} else if s.Moved == nil && len(s.Changes) == 0 {
+			continue
+		}
+
+		sites = append(sites, s)
+	}
+
+	for _, prev := range before {
+		if _, ok := old[prev.ID()]; ok && !seen[prev.ID()] {
+			sites = append(sites, Site{ID: prev.ID(), Name: prev.Name(), Status: Removed})
+			seen[prev.ID()] = true
+		}
+	}
+
+	sort.SliceStable(sites, func(i, j int) bool {
+		if sites[i].Status != sites[j].Status {
+			return statusOrder[sites[i].Status] < statusOrder[sites[j].Status]
+		}
+		return sites[i].Name < sites[j].Name
+	})
+
+	return sites
+}
+
+// changes compares the name, address, service types and the values of each attribute of a site
+func changes(prev, next serviceguiden.Content) []diff.Change {
+	before := values(prev)
+	after := values(next)
+
+	changes := []diff.Change{}
+
+	for name, v := range after {
+		old, ok := before[name]
+		if !ok {
+			changes = append(changes, diff.Change{Attribute: name, Kind: diff.Added, New: v})
+		} else if !reflect.DeepEqual(old, v) {
+			changes = append(changes, diff.Change{Attribute: name, Kind: diff.Changed, Old: old, New: v})
+		}
+	}
+
+	for name, v := range before {
+		if _, ok := after[name]; !ok {
+			changes = append(changes, diff.Change{Attribute: name, Kind: diff.Removed, Old: v})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Attribute < changes[j].Attribute
+	})
+
+	return changes
+}
+
+func values(c serviceguiden.Content) map[string]any {
+	v := map[string]any{}
+
+	if c.Name() != "" {
+		v["name"] = c.Name()
+	}
+
+	if c.Address() != "" {
+		v["visitingAddress"] = c.Address()
+	}
+
+	serviceTypes := []string{}
+	for _, t := range c.ServiceTypes {
+		serviceTypes = append(serviceTypes, t.Name)
+	}
+	if len(serviceTypes) > 0 {
+		sort.Strings(serviceTypes)
+		v["serviceTypes"] = serviceTypes
+	}
+
+	for name, values := range c.Attributes() {
+		sort.Strings(values)
+		v[name] = values
+	}
+
+	return v
+}
+
+func hasAnyServiceType(c serviceguiden.Content, names []string) bool {
+	if len(names) == 0 {
+		return true
+	}
+	for _, serviceType := range c.ServiceTypes {
+		for _, name := range names {
+			if strings.EqualFold(serviceType.Name, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func WriteJSON(w io.Writer, sites []Site) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sites)
+}
+
+// WriteText writes a human readable summary of each site and its changes
+func WriteText(w io.Writer, sites []Site) error {
+	var err error
+
+	printf := func(format string, a ...any) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, a...)
+		}
+	}
+
+	for _, s := range sites {
+		printf("%s %s (%s)\n", s.Status, s.ID, s.Name)
+
+		if s.Moved != nil {
+			printf("  moved %.0f m: %f,%f -> %f,%f\n", s.Moved.Distance, s.Moved.From.Latitude, s.Moved.From.Longitude, s.Moved.To.Latitude, s.Moved.To.Longitude)
+		}
+
+		for _, c := range s.Changes {
+			switch c.Kind {
+			case diff.Added:
+				printf("  + %s: %v\n", c.Attribute, c.New)
+			case diff.Changed:
+				printf("  ~ %s: %v -> %v\n", c.Attribute, c.Old, c.New)
+			case diff.Removed:
+				printf("  - %s: %v\n", c.Attribute, c.Old)
+			}
+		}
+	}
+
+	return err
+}
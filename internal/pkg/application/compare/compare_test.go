@@ -0,0 +1,83 @@
+package compare
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/diff"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/serviceguiden"
+	"github.com/matryer/is"
+)
+
+func TestSites(t *testing.T) {
+	is := is.New(t)
+
+	before := []serviceguiden.Content{
+		beach("1", "Askimsbadet", 57.6300, 11.9300, "Hav"),
+		beach("2", "Saltholmen", 57.6600, 11.8400, "Hav"),
+		beach("3", "Delsjön", 57.6900, 12.0400, "Sjö"),
+		beach("4", "Kärralundsbadet", 57.7000, 12.0300, "Sjö"),
+		beach("5", "Härlanda tjärn", 57.7100, 12.0500, "Sjö"),
+		library("6", "Stadsbiblioteket"),
+	}
+
+	moved := beach("2", "Saltholmen", 57.6610, 11.8400, "Hav")
+	deleted := beach("3", "Delsjön", 57.6900, 12.0400, "Sjö")
+	deleted.Deleted = true
+
+	after := []serviceguiden.Content{
+		beach("1", "Askimsbadet", 57.6300, 11.9301, "Hav"),
+		moved,
+		deleted,
+		beach("5", "Härlanda tjärn", 57.7100, 12.0500, "Sjö", "Hav"),
+		beach("7", "Ruddalen", 57.6700, 11.9800, "Sjö"),
+	}
+
+	sites := Sites(before, after, Options{ServiceTypes: []string{"Badplatser"}, MinDistance: 25})
+
+	// Askimsbadet moved about 6 metres, which is below the threshold, and the library is not a beach
+	is.Equal(len(sites), 5)
+	is.Equal(sites[0].Status, Removed)
+	is.Equal(sites[0].ID, "4")
+	is.Equal(sites[1].Status, Deleted)
+	is.Equal(sites[1].ID, "3")
+	is.Equal(sites[2].Status, Added)
+	is.Equal(sites[2].ID, "7")
+
+	is.Equal(sites[3].ID, "5")
+	is.Equal(sites[3].Moved, nil)
+	is.Equal(sites[3].Changes, []diff.Change{{Attribute: "Inriktning", Kind: diff.Changed, Old: []string{"Sjö"}, New: []string{"Hav", "Sjö"}}})
+
+	is.Equal(sites[4].ID, "2")
+	is.True(sites[4].Moved != nil)
+	is.True(sites[4].Moved.Distance > 100 && sites[4].Moved.Distance < 120)
+	is.Equal(len(sites[4].Changes), 0)
+
+	var buf bytes.Buffer
+	is.NoErr(WriteText(&buf, sites))
+	is.True(strings.Contains(buf.String(), "removed 4 (Kärralundsbadet)\n"))
+	is.True(strings.Contains(buf.String(), "  ~ Inriktning: [Sjö] -> [Hav Sjö]\n"))
+	is.True(strings.Contains(buf.String(), "  moved 111 m"))
+}
+
+func beach(id, name string, lat, lon float64, inriktning ...string) serviceguiden.Content {
+	values := []serviceguiden.Value{}
+	for _, v := range inriktning {
+		values = append(values, serviceguiden.Value{Name: v})
+	}
+
+	return serviceguiden.Content{
+		ID_:       id,
+		Name_:     name,
+		Position_: serviceguiden.Position{Latitude: lat, Longitude: lon},
+		ServiceTypes: []serviceguiden.ServiceType{{
+			Name:       "Badplatser",
+			Attributes: []serviceguiden.Attribute{{Name: "Inriktning", Values: values}},
+		}},
+	}
+}
+
+func library(id, name string) serviceguiden.Content {
+	return serviceguiden.Content{ID_: id, Name_: name, ServiceTypes: []serviceguiden.ServiceType{{Name: "Bibliotek"}}}
+}
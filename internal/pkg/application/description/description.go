@@ -0,0 +1,311 @@
+package description
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+type Format string
+
+const (
+	// Raw is the description exactly as it is in ServiceGuiden
+	Raw Format = "raw"
+	// HTML is the description with unsafe markup removed and links resolved
+	HTML     Format = "html"
+	Text     Format = "text"
+	Markdown Format = "markdown"
+)
+
+// Formats are all known formats
+var Formats = []Format{Raw, HTML, Text, Markdown}
+
+// ParseFormats parses a comma separated list of formats
+func ParseFormats(s string) ([]Format, error) {
+	formats := []Format{}
+
+	for _, f := range strings.Split(s, ",") {
+		switch format := Format(strings.ToLower(strings.TrimSpace(f))); format {
+		case Raw, HTML, Text, Markdown:
+			formats = append(formats, format)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown description format %q", f)
+		}
+	}
+
+	if len(formats) == 0 {
+		return nil, fmt.Errorf("at least one description format is required")
+	}
+
+	return formats, nil
+}
+
+// Convert returns a description in the given format
+func Convert(description string, format Format, base *url.URL) string {
+	switch format {
+	case HTML:
+		return Sanitize(description, base)
+	case Text:
+		return PlainText(description)
+	case Markdown:
+		return ToMarkdown(description, base)
+	}
+	return description
+}
+
+// allowed elements and the attributes that are kept on them, everything else is unwrapped
+var allowed = map[atom.Atom][]string{
+	atom.P: nil, atom.Br: nil, atom.Strong: nil, atom.B: nil, atom.Em: nil, atom.I: nil,
+	atom.Ul: nil, atom.Ol: nil, atom.Li: nil, atom.H2: nil, atom.H3: nil, atom.H4: nil,
+	atom.A: {"href"},
+}
+
+// dropped elements are removed together with their contents
+var dropped = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Iframe: true, atom.Object: true, atom.Embed: true,
+	atom.Form: true, atom.Noscript: true, atom.Template: true, atom.Svg: true,
+}
+
+// void elements never have an end tag, and thus no contents to drop
+var void = map[atom.Atom]bool{
+	atom.Embed: true,
+}
+
+var whitespace = regexp.MustCompile(`\s+`)
+
+// Sanitize removes elements and attributes that are not allowed, links with unsafe schemes and
+// line breaks from a description. Relative links are resolved against base.
+func Sanitize(description string, base *url.URL) string {
+	var b strings.Builder
+
+	walk(description, func(tt html.TokenType, t html.Token) {
+		switch tt {
+		case html.TextToken:
+			b.WriteString(html.EscapeString(whitespace.ReplaceAllString(t.Data, " ")))
+		case html.StartTagToken, html.SelfClosingTagToken:
+			attrs, ok := allowed[t.DataAtom]
+			if !ok {
+				return
+			}
+
+			b.WriteString("<" + t.Data)
+			for _, a := range t.Attr {
+				if !contains(attrs, a.Key) {
+					continue
+				}
+				if a.Key == "href" {
+					href, ok := resolve(a.Val, base)
+					if !ok {
+						continue
+					}
+					a.Val = href
+				}
+				fmt.Fprintf(&b, ` %s="%s"`, a.Key, html.EscapeString(a.Val))
+			}
+
+			if tt == html.SelfClosingTagToken || t.DataAtom == atom.Br {
+				b.WriteString(">")
+				return
+			}
+			b.WriteString(">")
+		case html.EndTagToken:
+			if _, ok := allowed[t.DataAtom]; ok && t.DataAtom != atom.Br {
+				b.WriteString("</" + t.Data + ">")
+			}
+		}
+	})
+
+	return strings.TrimSpace(b.String())
+}
+
+// PlainText returns the text of a description, with paragraphs separated by blank lines
+func PlainText(description string) string {
+	var b strings.Builder
+
+	walk(description, func(tt html.TokenType, t html.Token) {
+		switch tt {
+		case html.TextToken:
+			b.WriteString(whitespace.ReplaceAllString(t.Data, " "))
+		case html.StartTagToken, html.SelfClosingTagToken:
+			switch t.DataAtom {
+			case atom.Br:
+				b.WriteString("\n")
+			case atom.Li:
+				b.WriteString("\n- ")
+			}
+		case html.EndTagToken:
+			if isBlock(t.DataAtom) {
+				b.WriteString("\n\n")
+			}
+		}
+	})
+
+	return tidy(b.String())
+}
+
+// ToMarkdown converts a description to Markdown. Relative links are resolved against base.
+func ToMarkdown(description string, base *url.URL) string {
+	var b strings.Builder
+	hrefs := []string{}
+
+	walk(description, func(tt html.TokenType, t html.Token) {
+		switch tt {
+		case html.TextToken:
+			b.WriteString(escapeMarkdown(whitespace.ReplaceAllString(t.Data, " ")))
+		case html.StartTagToken, html.SelfClosingTagToken:
+			switch t.DataAtom {
+			case atom.Br:
+				b.WriteString("  \n")
+			case atom.Li:
+				b.WriteString("\n- ")
+			case atom.Strong, atom.B:
+				b.WriteString("**")
+			case atom.Em, atom.I:
+				b.WriteString("*")
+			case atom.H2:
+				b.WriteString("## ")
+			case atom.H3:
+				b.WriteString("### ")
+			case atom.H4:
+				b.WriteString("#### ")
+			case atom.A:
+				href, _ := resolve(attr(t, "href"), base)
+				hrefs = append(hrefs, href)
+				if href != "" {
+					b.WriteString("[")
+				}
+			}
+		case html.EndTagToken:
+			switch t.DataAtom {
+			case atom.Strong, atom.B:
+				b.WriteString("**")
+			case atom.Em, atom.I:
+				b.WriteString("*")
+			case atom.A:
+				if len(hrefs) == 0 {
+					return
+				}
+				href := hrefs[len(hrefs)-1]
+				hrefs = hrefs[:len(hrefs)-1]
+				if href != "" {
+					b.WriteString("](" + href + ")")
+				}
+			default:
+				if isBlock(t.DataAtom) {
+					b.WriteString("\n\n")
+				}
+			}
+		}
+	})
+
+	return tidy(b.String())
+}
+
+// walk calls f for each token that is not inside a dropped element
+func walk(description string, f func(html.TokenType, html.Token)) {
+	z := html.NewTokenizer(strings.NewReader(description))
+	depth := 0
+
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return
+		}
+
+		t := z.Token()
+
+		if dropped[t.DataAtom] {
+			// self closing tags, such as <svg/>, are dropped without changing the depth
+			if !void[t.DataAtom] {
+				switch tt {
+				case html.StartTagToken:
+					depth++
+				case html.EndTagToken:
+					depth = max(0, depth-1)
+				}
+			}
+			continue
+		}
+
+		if depth > 0 || tt == html.CommentToken || tt == html.DoctypeToken {
+			continue
+		}
+
+		f(tt, t)
+	}
+}
+
+func isBlock(a atom.Atom) bool {
+	switch a {
+	case atom.P, atom.Div, atom.Ul, atom.Ol, atom.H1, atom.H2, atom.H3, atom.H4, atom.Table, atom.Tr:
+		return true
+	}
+	return false
+}
+
+// resolve makes a link absolute and reports false for links that are neither http, https nor mailto
+func resolve(href string, base *url.URL) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil || href == "" {
+		return "", false
+	}
+
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return u.String(), true
+	}
+
+	return "", false
+}
+
+func attr(t html.Token, key string) string {
+	for _, a := range t.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+var markdownSpecial = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`, "`", "\\`")
+
+func escapeMarkdown(s string) string {
+	return markdownSpecial.Replace(s)
+}
+
+var (
+	spaceAroundNewline = regexp.MustCompile(`[ \t]*\n[ \t]*`)
+	blankLines         = regexp.MustCompile(`\n{3,}`)
+	// empty emphasis is left behind by markup such as <strong> </strong>
+	emptyEmphasis = regexp.MustCompile(`\*\*\s*\*\*`)
+)
+
+func tidy(s string) string {
+	s = emptyEmphasis.ReplaceAllString(s, "")
+	s = spaceAroundNewline.ReplaceAllStringFunc(s, func(m string) string {
+		if strings.HasPrefix(m, "  \n") {
+			return "  \n" // markdown line break
+		}
+		return "\n"
+	})
+	s = blankLines.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
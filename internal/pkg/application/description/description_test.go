@@ -0,0 +1,79 @@
+package description
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+var base, _ = url.Parse("https://goteborg.se")
+
+func TestSanitize(t *testing.T) {
+	is := is.New(t)
+
+	html := Sanitize(askimsbadet, base)
+
+	is.True(!strings.Contains(html, "<span"))
+	is.True(!strings.Contains(html, "\r\n"))
+	is.True(!strings.Contains(html, "target="))
+	is.True(!strings.Contains(html, "<script"))
+	is.True(!strings.Contains(html, "alert"))
+	is.True(!strings.Contains(html, "javascript:"))
+	is.True(!strings.Contains(html, "onclick"))
+	is.True(strings.Contains(html, `<p><strong>Avrådan från bad vid Askimsbadet</strong></p>`))
+	is.True(strings.Contains(html, `<a href="https://goteborg.se/wps/portal?uri=gbglnk%3a20201219207511">Toaletterna är öppna under badsäsongen.</a>`))
+	is.True(strings.Contains(html, `<a>Klicka här</a>`))
+}
+
+func TestSanitizeKeepsTextAfterVoidElements(t *testing.T) {
+	is := is.New(t)
+
+	html := Sanitize("<p>Före<embed src=x>efter</p><p>Karta<svg/>nedan</p><p>Film<iframe src=y>dold</iframe>slut</p>", base)
+
+	is.Equal("<p>Föreefter</p><p>Kartanedan</p><p>Filmslut</p>", html)
+}
+
+func TestPlainText(t *testing.T) {
+	is := is.New(t)
+
+	text := PlainText(askimsbadet)
+
+	is.True(strings.HasPrefix(text, "Avrådan från bad vid Askimsbadet\n\nPå grund av höga bakteriehalter"))
+	is.True(strings.Contains(text, "\n- Kafé\n- Lekplats"))
+	is.True(!strings.Contains(text, "<"))
+	is.True(!strings.Contains(text, "alert"))
+}
+
+func TestToMarkdown(t *testing.T) {
+	is := is.New(t)
+
+	md := ToMarkdown(askimsbadet, base)
+
+	is.True(strings.HasPrefix(md, "**Avrådan från bad vid Askimsbadet**\n\n"))
+	is.True(strings.Contains(md, "[Toaletterna är öppna under badsäsongen.](https://goteborg.se/wps/portal?uri=gbglnk%3a20201219207511)"))
+	is.True(strings.Contains(md, "Klicka här")) // the unsafe link is dropped but the text is kept
+	is.True(!strings.Contains(md, "javascript:"))
+}
+
+func TestParseFormats(t *testing.T) {
+	is := is.New(t)
+
+	formats, err := ParseFormats("html, Text")
+	is.NoErr(err)
+	is.Equal([]Format{HTML, Text}, formats)
+
+	_, err = ParseFormats("pdf")
+	is.True(err != nil)
+
+	_, err = ParseFormats("")
+	is.True(err != nil)
+}
+
+const askimsbadet string = "<p><strong>Avrådan från bad vid Askimsbadet</strong></p>\r\n" +
+	"<p><span>På grund av höga bakteriehalter har Göteborgs Stad beslutat om avrådan från bad vid Askimsbadet från och med 13 augusti.</span></p>\r\n" +
+	"<p><a href=\"/wps/portal?uri=gbglnk%3a20201219207511\" target=\"_self\">Toaletterna är öppna under badsäsongen.</a></p>\r\n" +
+	"<ul><li>Kafé</li><li>Lekplats</li></ul>\r\n" +
+	"<script>alert('hej')</script>\r\n" +
+	"<p><a href=\"javascript:alert(1)\" onclick=\"alert(2)\">Klicka här</a></p>"
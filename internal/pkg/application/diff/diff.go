@@ -0,0 +1,113 @@
+package diff
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+)
+
+type Kind string
+
+const (
+	Added   Kind = "added"
+	Changed Kind = "changed"
+	Removed Kind = "removed"
+)
+
+// Null is the NGSI-LD null value. An attribute with this value in a merge is deleted from the entity.
+const Null string = "urn:ngsi-ld:null"
+
+type Change struct {
+	Attribute string `json:"attribute"`
+	Kind      Kind   `json:"kind"`
+	Old       any    `json:"old,omitempty"`
+	New       any    `json:"new,omitempty"`
+}
+
+// Compare returns the attribute level changes that merging next into current would make, sorted by attribute name.
+// Attributes that are missing in next are kept by a merge, so only attributes set to Null are reported as removed.
+// A nil current is treated as an entity without attributes.
+func Compare(current, next types.EntityFragment) ([]Change, error) {
+	before, err := attributeValues(current)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := attributeValues(next)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+
+	for name, v := range after {
+		old, ok := before[name]
+		if v == Null {
+			if ok {
+				changes = append(changes, Change{Attribute: name, Kind: Removed, Old: old})
+			}
+			continue
+		}
+
+		if !ok {
+			changes = append(changes, Change{Attribute: name, Kind: Added, New: v})
+		} else if !reflect.DeepEqual(old, v) {
+			changes = append(changes, Change{Attribute: name, Kind: Changed, Old: old, New: v})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Attribute < changes[j].Attribute
+	})
+
+	return changes, nil
+}
+
+// attributeValues maps each attribute name to the value of a property, or the object of a relationship,
+// as decoded from JSON so that values from different sources can be compared
+func attributeValues(fragment types.EntityFragment) (map[string]any, error) {
+	values := map[string]any{}
+
+	if fragment == nil {
+		return values, nil
+	}
+
+	if v := reflect.ValueOf(fragment); v.Kind() == reflect.Pointer && v.IsNil() {
+		return values, nil
+	}
+
+	var err error
+
+	fragment.ForEachAttribute(func(attributeType, attributeName string, contents any) {
+		if err != nil {
+			return
+		}
+
+		var b []byte
+		b, err = json.Marshal(contents)
+		if err != nil {
+			return
+		}
+
+		if string(b) == `"`+Null+`"` {
+			values[attributeName] = Null
+			return
+		}
+
+		attr := map[string]any{}
+		err = json.Unmarshal(b, &attr)
+		if err != nil {
+			return
+		}
+
+		if attributeType == "Relationship" {
+			values[attributeName] = attr["object"]
+		} else {
+			values[attributeName] = attr["value"]
+		}
+	})
+
+	return values, err
+}
@@ -0,0 +1,76 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+	"github.com/matryer/is"
+)
+
+func TestCompare(t *testing.T) {
+	is := is.New(t)
+
+	current, _ := entities.New("urn:ngsi-ld:Beach:1", "Beach",
+		decorators.Name("Askimsbadet"),
+		decorators.Text("description", "old description"),
+		decorators.Text("areaServed", "Sydväst"),
+		decorators.TextList("beachType", []string{"Hav"}),
+	)
+
+	next, _ := entities.NewFragment(
+		decorators.Name("Askimsbadet"),
+		decorators.Text("description", "new description"),
+		decorators.TextList("beachType", []string{"Hav"}),
+		decorators.RefDevice("urn:ngsi-ld:Device:temp-01"),
+		entities.P("areaServed", null{}),
+	)
+
+	changes, err := Compare(current, next)
+	is.NoErr(err)
+	is.Equal(3, len(changes))
+
+	is.Equal(Change{Attribute: "areaServed", Kind: Removed, Old: "Sydväst"}, changes[0])
+	is.Equal(Change{Attribute: "description", Kind: Changed, Old: "old description", New: "new description"}, changes[1])
+	is.Equal(Change{Attribute: "refDevice", Kind: Added, New: "urn:ngsi-ld:Device:temp-01"}, changes[2])
+}
+
+func TestCompareWithMissingEntity(t *testing.T) {
+	is := is.New(t)
+
+	next, _ := entities.NewFragment(decorators.Name("Askimsbadet"))
+
+	changes, err := Compare(nil, next)
+	is.NoErr(err)
+	is.Equal(1, len(changes))
+	is.Equal(Added, changes[0].Kind)
+}
+
+func TestCompareKeepsAttributesThatAreNotInNext(t *testing.T) {
+	is := is.New(t)
+
+	current, _ := entities.New("urn:ngsi-ld:Beach:1", "Beach",
+		decorators.Name("Askimsbadet"),
+		decorators.Status("retired"),
+		decorators.DateCreated("2024-05-01T12:00:00Z"),
+		decorators.Text("contentHash", "abc"),
+		decorators.RefDevice("urn:ngsi-ld:Device:temp-01"),
+	)
+
+	next, _ := entities.NewFragment(
+		decorators.Name("Askimsbadet"),
+		entities.P("seasonalToilets", null{}),
+	)
+
+	changes, err := Compare(current, next)
+	is.NoErr(err)
+	is.Equal(0, len(changes)) // a merge keeps the other attributes and there is nothing to delete
+}
+
+// null is a property that is marshalled as the NGSI-LD null value
+type null struct{}
+
+func (null) Type() string { return "Property" }
+func (null) Value() any   { return Null }
+
+func (null) MarshalJSON() ([]byte, error) { return []byte(`"` + Null + `"`), nil }
@@ -0,0 +1,173 @@
+package geometry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+)
+
+// The property in a GeoJSON feature that holds the ServiceGuiden id. The feature id is used if the property is missing.
+const IDProperty string = "serviceguiden_id"
+
+const earthRadius float64 = 6378137.0
+const bufferSegments int = 16
+
+type Source interface {
+	// MultiPolygon returns the known shape of a site, or a buffer polygon around its position if the shape is unknown
+	MultiPolygon(serviceGuidenID string, latitude, longitude float64) [][][][]float64
+}
+
+type source struct {
+	shapes       map[string][][][][]float64
+	bufferRadius float64
+}
+
+// New creates a geometry source from a GeoJSON FeatureCollection. A missing file is not an error,
+// every site will then be given a buffer polygon with a radius of bufferRadius metres.
+func New(ctx context.Context, filePath string, bufferRadius float64) (Source, error) {
+	log := logging.GetFromContext(ctx)
+
+	if bufferRadius <= 0 {
+		return nil, fmt.Errorf("buffer radius must be greater than zero, got %f", bufferRadius)
+	}
+
+	s := &source{
+		shapes:       map[string][][][][]float64{},
+		bufferRadius: bufferRadius,
+	}
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		log.Debug("geometry file not found, using buffer polygons", slog.String("filepath", filePath))
+		return s, nil
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open geometry file %s: %w", filePath, err)
+	}
+	defer f.Close()
+
+	s.shapes, err = load(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not load geometries from %s: %w", filePath, err)
+	}
+
+	log.Debug("geometries loaded from file", slog.Int("count", len(s.shapes)), slog.String("filepath", filePath))
+
+	return s, nil
+}
+
+type featureCollection struct {
+	Type     string    `json:"type"`
+	Features []feature `json:"features"`
+}
+
+type feature struct {
+	ID         any            `json:"id"`
+	Properties map[string]any `json:"properties"`
+	Geometry   struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	} `json:"geometry"`
+}
+
+func load(r io.Reader) (map[string][][][][]float64, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var fc featureCollection
+	err = json.Unmarshal(b, &fc)
+	if err != nil {
+		return nil, err
+	}
+
+	if fc.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("expected a FeatureCollection, but got %q", fc.Type)
+	}
+
+	shapes := map[string][][][][]float64{}
+
+	for idx, f := range fc.Features {
+		id := featureID(f)
+		if id == "" {
+			return nil, fmt.Errorf("feature %d has no %s property or id", idx, IDProperty)
+		}
+
+		switch f.Geometry.Type {
+		case "Polygon":
+			var polygon [][][]float64
+			if err = json.Unmarshal(f.Geometry.Coordinates, &polygon); err != nil {
+				return nil, fmt.Errorf("feature %d (%s) has invalid coordinates: %w", idx, id, err)
+			}
+			shapes[id] = [][][][]float64{polygon}
+		case "MultiPolygon":
+			var multipolygon [][][][]float64
+			if err = json.Unmarshal(f.Geometry.Coordinates, &multipolygon); err != nil {
+				return nil, fmt.Errorf("feature %d (%s) has invalid coordinates: %w", idx, id, err)
+			}
+			shapes[id] = multipolygon
+		default:
+			return nil, fmt.Errorf("feature %d (%s) has unsupported geometry type %q", idx, id, f.Geometry.Type)
+		}
+	}
+
+	return shapes, nil
+}
+
+func featureID(f feature) string {
+	if id, ok := f.Properties[IDProperty].(string); ok && id != "" {
+		return id
+	}
+
+	if id, ok := f.ID.(string); ok {
+		return id
+	}
+
+	return ""
+}
+
+func (s source) MultiPolygon(serviceGuidenID string, latitude, longitude float64) [][][][]float64 {
+	if shape, ok := s.shapes[serviceGuidenID]; ok {
+		return shape
+	}
+
+	return [][][][]float64{{Buffer(latitude, longitude, s.bufferRadius)}}
+}
+
+// Buffer returns a closed, counterclockwise ring approximating a circle with a radius in metres around a point
+func Buffer(latitude, longitude, radius float64) [][]float64 {
+	dLat := (radius / earthRadius) * (180 / math.Pi)
+	dLon := dLat / math.Cos(latitude*math.Pi/180)
+
+	ring := make([][]float64, 0, bufferSegments+1)
+
+	for i := 0; i < bufferSegments; i++ {
+		angle := 2 * math.Pi * float64(i) / float64(bufferSegments)
+		ring = append(ring, []float64{
+			longitude + dLon*math.Cos(angle),
+			latitude + dLat*math.Sin(angle),
+		})
+	}
+
+	return append(ring, ring[0])
+}
+
+// Distance returns the great-circle distance in metres between two points
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,80 @@
+package geometry
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestLoadPolygonAndMultiPolygon(t *testing.T) {
+	is := is.New(t)
+
+	shapes, err := load(strings.NewReader(featureCollectionJSON))
+	is.NoErr(err)
+	is.Equal(2, len(shapes))
+	is.Equal(1, len(shapes["61e0a244cfc4d247cca95f4e"]))
+	is.Equal(2, len(shapes["61e0a239cfc4d247cca957bf"]))
+}
+
+func TestLoadFailsOnMissingID(t *testing.T) {
+	is := is.New(t)
+
+	_, err := load(strings.NewReader(`{"type":"FeatureCollection","features":[{"properties":{},"geometry":{"type":"Polygon","coordinates":[]}}]}`))
+	is.True(err != nil)
+}
+
+func TestFallbackToBuffer(t *testing.T) {
+	is := is.New(t)
+
+	s := source{shapes: map[string][][][][]float64{}, bufferRadius: 50}
+
+	shape := s.MultiPolygon("unknown", 57.62595719307582, 11.92624964921406)
+	is.Equal(1, len(shape))
+
+	ring := shape[0][0]
+	is.Equal(bufferSegments+1, len(ring))
+	is.Equal(ring[0], ring[len(ring)-1])
+
+	// the northernmost point should be roughly 50 metres from the center
+	north := ring[bufferSegments/4]
+	metres := (north[1] - 57.62595719307582) * math.Pi / 180 * earthRadius
+	is.True(math.Abs(metres-50) < 0.01)
+}
+
+func TestDistance(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(0.0, Distance(57.62595719307582, 11.92624964921406, 57.62595719307582, 11.92624964921406))
+
+	// one degree of latitude is roughly 111 km
+	metres := Distance(57.0, 11.9, 58.0, 11.9)
+	is.True(math.Abs(metres-111319) < 1)
+}
+
+const featureCollectionJSON string = `{
+	"type": "FeatureCollection",
+	"features": [
+		{
+			"type": "Feature",
+			"properties": {"serviceguiden_id": "61e0a244cfc4d247cca95f4e", "name": "Askimsbadet"},
+			"geometry": {
+				"type": "Polygon",
+				"coordinates": [[[11.925, 57.625], [11.927, 57.625], [11.927, 57.627], [11.925, 57.625]]]
+			}
+		},
+		{
+			"type": "Feature",
+			"id": "61e0a239cfc4d247cca957bf",
+			"properties": {"name": "Allmänna badet"},
+			"geometry": {
+				"type": "MultiPolygon",
+				"coordinates": [
+					[[[11.90, 57.65], [11.91, 57.65], [11.91, 57.66], [11.90, 57.65]]],
+					[[[11.92, 57.65], [11.93, 57.65], [11.93, 57.66], [11.92, 57.65]]]
+				]
+			}
+		}
+	]
+}`
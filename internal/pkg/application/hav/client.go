@@ -0,0 +1,113 @@
+package hav
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+)
+
+const DefaultProfileURL string = "https://badplatsen.havochvatten.se/badplatsen/api/testlocationprofile"
+
+// Client reads bathing water profiles from Havs- och vattenmyndigheten
+type Client interface {
+	// Profile returns the bathing water profile, including sample results, of a bathing site
+	Profile(ctx context.Context, nutsCode string) (*Profile, error)
+}
+
+type Profile struct {
+	NutsCode      string   `json:"nutsCode"`
+	LocationName  string   `json:"locationName"`
+	SampleResults []Sample `json:"sampleResults"`
+}
+
+// Sample is the result of a water sample. Counts are given per 100 ml and may have a prefix such as "<".
+type Sample struct {
+	SampleDate                  int64    `json:"sampleDate"`
+	WaterTemp                   *float64 `json:"waterTemp,omitempty"`
+	EscherichiaColiPrefix       string   `json:"escherichiaColiPrefix,omitempty"`
+	EscherichiaColiCount        *float64 `json:"escherichiaColiCount,omitempty"`
+	IntestinalEnterococciPrefix string   `json:"intestinalEnterococciPrefix,omitempty"`
+	IntestinalEnterococciCount  *float64 `json:"intestinalEnterococciCount,omitempty"`
+	SampleAssessIdText          string   `json:"sampleAssessIdText,omitempty"`
+}
+
+// Time returns the time when the sample was taken
+func (s Sample) Time() time.Time {
+	return time.UnixMilli(s.SampleDate).UTC()
+}
+
+// Latest returns at most count samples, with the most recent first
+func (p Profile) Latest(count int) []Sample {
+	samples := make([]Sample, len(p.SampleResults))
+	copy(samples, p.SampleResults)
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].SampleDate > samples[j].SampleDate
+	})
+
+	return samples[:min(count, len(samples))]
+}
+
+type client struct {
+	profileUrl string
+	httpClient http.Client
+}
+
+func NewClient(profileUrl string) Client {
+	return &client{
+		profileUrl: strings.TrimSuffix(profileUrl, "/"),
+		httpClient: http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+	}
+}
+
+var tracer = otel.Tracer("integration-cip-gbg-ms/hav")
+
+func (c *client) Profile(ctx context.Context, nutsCode string) (*Profile, error) {
+	var err error
+
+	ctx, span := tracer.Start(ctx, "integration-cip-gbg-ms/hav/profile")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.profileUrl+"/"+url.PathEscape(nutsCode), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve profile %s: %w", nutsCode, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("failed to retrieve profile %s, expected status code %d, but got %d", nutsCode, http.StatusOK, resp.StatusCode)
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	profile := &Profile{}
+
+	err = json.Unmarshal(body, profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal profile %s: %w", nutsCode, err)
+	}
+
+	return profile, nil
+}
@@ -0,0 +1,49 @@
+package hav
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestProfile(t *testing.T) {
+	is := is.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/testlocationprofile/SE0A21480000000532" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(profileJSON))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL + "/testlocationprofile/")
+
+	profile, err := c.Profile(context.Background(), "SE0A21480000000532")
+	is.NoErr(err)
+
+	is.Equal("Askimsbadet", profile.LocationName)
+	is.Equal(2, len(profile.SampleResults))
+
+	latest := profile.Latest(1)
+	is.Equal(1, len(latest))
+	is.Equal("2024-07-15T08:00:00Z", latest[0].Time().Format("2006-01-02T15:04:05Z"))
+	is.Equal(18.5, *latest[0].WaterTemp)
+
+	_, err = c.Profile(context.Background(), "SE0A21480000000000")
+	is.True(err != nil)
+}
+
+const profileJSON string = `{
+	"nutsCode": "SE0A21480000000532",
+	"locationName": "Askimsbadet",
+	"sampleResults": [
+		{"sampleDate": 1719820800000, "waterTemp": 17, "escherichiaColiPrefix": "<", "escherichiaColiCount": 10, "intestinalEnterococciCount": 20, "sampleAssessIdText": "Tjänligt"},
+		{"sampleDate": 1721030400000, "waterTemp": 18.5, "escherichiaColiCount": 100, "intestinalEnterococciPrefix": "<", "intestinalEnterococciCount": 10, "sampleAssessIdText": "Tjänligt med anmärkning"}
+	]
+}`
@@ -0,0 +1,190 @@
+package hav
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BathingSite is a bathing site from a Havs- och vattenmyndigheten export
+type BathingSite struct {
+	NutsCode  string  `json:"nutsCode"`
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Column and property names that are recognised in exports, compared without regard to case
+var (
+	nutsCodeKeys  = []string{"nutscode", "nuts_code", "nutskod", "nuts"}
+	nameKeys      = []string{"name", "namn", "badplatsnamn", "locationname"}
+	latitudeKeys  = []string{"latitude", "latitud", "lat"}
+	longitudeKeys = []string{"longitude", "longitud", "lon", "lng"}
+)
+
+// LoadBathingSites reads an export as CSV, separated by semicolons or commas, or as JSON depending on the file extension
+func LoadBathingSites(filePath string) ([]BathingSite, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open file %s: %w", filePath, err)
+	}
+	defer f.Close()
+
+	var sites []BathingSite
+
+	if strings.EqualFold(filepath.Ext(filePath), ".json") {
+		sites, err = loadJSON(f)
+	} else {
+		sites, err = loadCSV(f)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to load bathing sites from %s: %w", filePath, err)
+	}
+
+	return sites, nil
+}
+
+func loadCSV(r io.Reader) ([]BathingSite, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	header, _, _ := strings.Cut(string(b), "\n")
+
+	reader := csv.NewReader(strings.NewReader(string(b)))
+	reader.Comma = ';'
+	if !strings.Contains(header, ";") {
+		reader.Comma = ','
+	}
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("file is empty")
+	}
+
+	columns := map[string]int{}
+	for idx, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = idx
+	}
+
+	column := func(keys []string) (int, bool) {
+		for _, k := range keys {
+			if idx, ok := columns[k]; ok {
+				return idx, true
+			}
+		}
+		return 0, false
+	}
+
+	nutsIdx, ok1 := column(nutsCodeKeys)
+	nameIdx, ok2 := column(nameKeys)
+	latIdx, ok3 := column(latitudeKeys)
+	lonIdx, ok4 := column(longitudeKeys)
+
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return nil, errors.New("line 1: expected columns with nuts code, name, latitude and longitude")
+	}
+
+	sites := []BathingSite{}
+
+	for idx, row := range rows[1:] {
+		lat, err := parseCoordinate(row[latIdx])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid latitude: %w", idx+2, err)
+		}
+
+		lon, err := parseCoordinate(row[lonIdx])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid longitude: %w", idx+2, err)
+		}
+
+		sites = append(sites, BathingSite{
+			NutsCode:  strings.TrimSpace(row[nutsIdx]),
+			Name:      strings.TrimSpace(row[nameIdx]),
+			Latitude:  lat,
+			Longitude: lon,
+		})
+	}
+
+	return sites, nil
+}
+
+func loadJSON(r io.Reader) ([]BathingSite, error) {
+	var items []map[string]any
+
+	err := json.NewDecoder(r).Decode(&items)
+	if err != nil {
+		return nil, err
+	}
+
+	sites := []BathingSite{}
+
+	for idx, item := range items {
+		values := map[string]any{}
+		for k, v := range item {
+			values[strings.ToLower(k)] = v
+		}
+
+		value := func(keys []string) any {
+			for _, k := range keys {
+				if v, ok := values[k]; ok {
+					return v
+				}
+			}
+			return nil
+		}
+
+		lat, err := coordinate(value(latitudeKeys))
+		if err != nil {
+			return nil, fmt.Errorf("item %d: invalid latitude: %w", idx, err)
+		}
+
+		lon, err := coordinate(value(longitudeKeys))
+		if err != nil {
+			return nil, fmt.Errorf("item %d: invalid longitude: %w", idx, err)
+		}
+
+		nutsCode, _ := value(nutsCodeKeys).(string)
+		name, _ := value(nameKeys).(string)
+
+		if nutsCode == "" {
+			return nil, fmt.Errorf("item %d: missing nuts code", idx)
+		}
+
+		sites = append(sites, BathingSite{
+			NutsCode:  nutsCode,
+			Name:      name,
+			Latitude:  lat,
+			Longitude: lon,
+		})
+	}
+
+	return sites, nil
+}
+
+func coordinate(v any) (float64, error) {
+	switch c := v.(type) {
+	case float64:
+		return c, nil
+	case string:
+		return parseCoordinate(c)
+	}
+	return 0, fmt.Errorf("unexpected value %v", v)
+}
+
+// parseCoordinate parses a decimal number that may use a comma as decimal separator
+func parseCoordinate(s string) (float64, error) {
+	return strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(s), ",", "."), 64)
+}
@@ -0,0 +1,42 @@
+package hav
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestLoadCSV(t *testing.T) {
+	is := is.New(t)
+
+	sites, err := loadCSV(strings.NewReader("NUTSKOD;NAMN;KOMMUN;LATITUD;LONGITUD\nSE0A21480000000532;Askimsbadet;Göteborg;57,6259;11,9262\n"))
+	is.NoErr(err)
+
+	is.Equal(1, len(sites))
+	is.Equal("SE0A21480000000532", sites[0].NutsCode)
+	is.Equal("Askimsbadet", sites[0].Name)
+	is.Equal(57.6259, sites[0].Latitude)
+	is.Equal(11.9262, sites[0].Longitude)
+}
+
+func TestLoadCSVRequiresColumns(t *testing.T) {
+	is := is.New(t)
+
+	_, err := loadCSV(strings.NewReader("nutsCode,name\nSE0A21480000000532,Askimsbadet\n"))
+	is.True(err != nil)
+
+	_, err = loadCSV(strings.NewReader("id;name;latitude;longitude\n4711;Askimsbadet;57.6259;11.9262\n"))
+	is.True(err != nil) // an id is not a NUTS code
+}
+
+func TestLoadJSON(t *testing.T) {
+	is := is.New(t)
+
+	sites, err := loadJSON(strings.NewReader(`[{"nutsCode":"SE0A21480000000532","locationName":"Askimsbadet","latitude":57.6259,"longitude":"11.9262"}]`))
+	is.NoErr(err)
+
+	is.Equal(1, len(sites))
+	is.Equal("Askimsbadet", sites[0].Name)
+	is.Equal(11.9262, sites[0].Longitude)
+}
@@ -0,0 +1,184 @@
+package health
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+)
+
+const (
+	Up      string = "up"
+	Down    string = "down"
+	Unknown string = "unknown"
+	Stale   string = "stale"
+
+	Ready    string = "ready"
+	Degraded string = "degraded"
+	NotReady string = "not ready"
+)
+
+// Upstream keeps track of whether a service was reachable on the last attempt to use it
+type Upstream struct {
+	mu        sync.Mutex
+	attempted bool
+	err       error
+	at        *time.Time
+}
+
+var (
+	ServiceGuiden = &Upstream{}
+	ContextBroker = &Upstream{}
+)
+
+// Attempt records the outcome of an attempt to use the upstream service
+func (u *Upstream) Attempt(err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.attempted = true
+	u.err = err
+	now := time.Now().UTC()
+	u.at = &now
+}
+
+// Check returns the status of the upstream service according to the last attempt
+func (u *Upstream) Check() Check {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if !u.attempted {
+		return Check{Status: Unknown}
+	}
+
+	if u.err != nil {
+		return Check{Status: Down, Error: u.err.Error(), CheckedAt: u.at}
+	}
+
+	return Check{Status: Up, CheckedAt: u.at}
+}
+
+// BrokerUnreachable returns err if it means that the context broker could not be reached or failed to
+// handle a request. Errors that the broker responds with for a valid request, such as an entity that
+// was not found, mean that the broker is reachable and are ignored.
+func BrokerUnreachable(err error) error {
+	for _, answered := range []error{ngsierrors.ErrNotFound, ngsierrors.ErrAlreadyExists, ngsierrors.ErrBadRequest, ngsierrors.ErrInvalidRequest, ngsierrors.ErrUnknownTenant} {
+		if errors.Is(err, answered) {
+			return nil
+		}
+	}
+	return err
+}
+
+type Check struct {
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	CheckedAt *time.Time `json:"checkedAt,omitempty"`
+}
+
+// LookupTableCheck is the status of the lookup table, with the generation and load time of the table in use
+type LookupTableCheck struct {
+	Check
+	Generation uint64     `json:"generation,omitempty"`
+	LoadedAt   *time.Time `json:"loadedAt,omitempty"`
+}
+
+type LastSync struct {
+	Status      string     `json:"status"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+}
+
+type Status struct {
+	Status        string           `json:"status"`
+	ServiceGuiden Check            `json:"serviceGuiden"`
+	ContextBroker Check            `json:"contextBroker"`
+	LookupTable   LookupTableCheck `json:"lookupTable"`
+	LastSync      LastSync         `json:"lastSync"`
+}
+
+// LookupTable is the state of a lookup table that is loaded, and possibly reloaded, from a file
+type LookupTable interface {
+	// Generation returns the number of times a table has been loaded
+	Generation() uint64
+	// LoadedAt returns the time when the table in use was loaded
+	LoadedAt() time.Time
+	// LastError returns the error from the latest attempt to load the table
+	LastError() error
+}
+
+// Checker decides whether the service is ready, from the state of its upstream services, its lookup
+// table and the time of the last successful sync
+type Checker struct {
+	lookupTable LookupTable
+	lastSuccess func() time.Time
+	maxAge      time.Duration
+	startedAt   time.Time
+}
+
+// NewChecker returns a checker that reports degraded when the last successful sync is older than
+// maxAge, or when no sync has succeeded for maxAge since the checker was created. A maxAge of zero
+// disables the check.
+func NewChecker(lookupTable LookupTable, lastSuccess func() time.Time, maxAge time.Duration) *Checker {
+	return &Checker{
+		lookupTable: lookupTable,
+		lastSuccess: lastSuccess,
+		maxAge:      maxAge,
+		startedAt:   time.Now(),
+	}
+}
+
+// Check returns NotReady if an upstream service was unreachable on the last attempt or if there is no
+// lookup table, and Degraded if the last successful sync is too old or if the lookup table file could
+// not be reloaded
+func (c *Checker) Check() Status {
+	s := Status{
+		Status:        Ready,
+		ServiceGuiden: ServiceGuiden.Check(),
+		ContextBroker: ContextBroker.Check(),
+		LookupTable:   c.checkLookupTable(),
+		LastSync:      c.checkLastSync(),
+	}
+
+	if s.LastSync.Status == Stale || s.LookupTable.Error != "" {
+		s.Status = Degraded
+	}
+
+	if s.ServiceGuiden.Status == Down || s.ContextBroker.Status == Down || s.LookupTable.Status == Down {
+		s.Status = NotReady
+	}
+
+	return s
+}
+
+func (c *Checker) checkLookupTable() LookupTableCheck {
+	if c.lookupTable == nil || c.lookupTable.Generation() == 0 {
+		return LookupTableCheck{Check: Check{Status: Down, Error: "lookup table not loaded"}}
+	}
+
+	loadedAt := c.lookupTable.LoadedAt()
+	s := LookupTableCheck{Check: Check{Status: Up}, Generation: c.lookupTable.Generation(), LoadedAt: &loadedAt}
+
+	if err := c.lookupTable.LastError(); err != nil {
+		// the last good table is still in use
+		s.Error = err.Error()
+	}
+
+	return s
+}
+
+func (c *Checker) checkLastSync() LastSync {
+	last := c.lastSuccess()
+
+	s := LastSync{Status: Up, LastSuccess: &last}
+	if last.IsZero() {
+		s = LastSync{Status: Unknown}
+		last = c.startedAt
+	}
+
+	if c.maxAge > 0 && time.Since(last) > c.maxAge {
+		s.Status = Stale
+	}
+
+	return s
+}
@@ -0,0 +1,74 @@
+package health
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/matryer/is"
+)
+
+func TestCheck(t *testing.T) {
+	is := is.New(t)
+
+	ServiceGuiden = &Upstream{}
+	ContextBroker = &Upstream{}
+
+	table := &lookupMock{generation: 1, loadedAt: time.Now().Add(-time.Minute)}
+	lastSuccess := time.Time{}
+
+	c := NewChecker(table, func() time.Time { return lastSuccess }, time.Hour)
+
+	is.Equal(Ready, c.Check().Status) // nothing has been attempted yet
+	is.Equal(Unknown, c.Check().LastSync.Status)
+
+	ServiceGuiden.Attempt(nil)
+	ContextBroker.Attempt(BrokerUnreachable(ngsierrors.NewNotFoundError("not found")))
+	lastSuccess = time.Now().Add(-2 * time.Hour)
+
+	s := c.Check()
+	is.Equal(Degraded, s.Status)
+	is.Equal(Stale, s.LastSync.Status)
+	is.Equal(Up, s.ContextBroker.Status)
+
+	lastSuccess = time.Now()
+	is.Equal(Ready, c.Check().Status)
+
+	table.err = errors.New("line 3: duplicate id")
+	s = c.Check()
+	is.Equal(Degraded, s.Status) // the last good table is still in use
+	is.Equal(uint64(1), s.LookupTable.Generation)
+	is.Equal(table.loadedAt, *s.LookupTable.LoadedAt)
+
+	ContextBroker.Attempt(BrokerUnreachable(fmt.Errorf("%w: connection refused", ngsierrors.ErrRequest)))
+
+	s = c.Check()
+	is.Equal(NotReady, s.Status)
+	is.Equal(Down, s.ContextBroker.Status)
+	is.Equal("request error: connection refused", s.ContextBroker.Error)
+}
+
+func TestCheckWithoutMaxAge(t *testing.T) {
+	is := is.New(t)
+
+	ServiceGuiden = &Upstream{}
+	ContextBroker = &Upstream{}
+
+	c := NewChecker(&lookupMock{generation: 1}, func() time.Time { return time.Now().Add(-24 * time.Hour) }, 0)
+	is.Equal(Ready, c.Check().Status)
+
+	c = NewChecker(&lookupMock{}, time.Now, 0)
+	is.Equal(NotReady, c.Check().Status) // no lookup table loaded
+}
+
+type lookupMock struct {
+	generation uint64
+	loadedAt   time.Time
+	err        error
+}
+
+func (m *lookupMock) Generation() uint64  { return m.generation }
+func (m *lookupMock) LoadedAt() time.Time { return m.loadedAt }
+func (m *lookupMock) LastError() error    { return m.err }
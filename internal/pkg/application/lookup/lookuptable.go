@@ -2,10 +2,12 @@ package lookup
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
-	"log/slog"
 	"os"
+	"regexp"
+	"strings"
 )
 
 type Lookup struct {
@@ -23,57 +25,109 @@ type impl struct {
 	table map[string]*Lookup
 }
 
-func fatal(log *slog.Logger, msg string, args ...string) {
-	log.Error(fmt.Sprintf(msg, args))
-	panic(msg)
-}
+const (
+	ServiceGuidenIdColumn string = "serviceguiden_id"
+	NutsCodeColumn        string = "nuts_code"
+	DeviceIdColumn        string = "device_id"
+)
 
-func New(logger *slog.Logger, filePath string) LookupTable {
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		fatal(logger, "file %s does not exist", filePath)
-	}
+// nutsCodePattern matches the bathing water ids used by Havs- och vattenmyndigheten, e.g. SE0A21480000000532
+var nutsCodePattern = regexp.MustCompile(`^[A-Z]{2}[0-9A-Z]{16}$`)
 
+func New(filePath string) (LookupTable, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		fatal(logger, "unable to open file %s", filePath)
+		return nil, fmt.Errorf("unable to open file %s: %w", filePath, err)
 	}
 	defer file.Close()
 
-	data, err := load(logger, file)
+	data, err := load(file)
 	if err != nil {
-		fatal(logger, "unable to load data from file %s", filePath)
+		return nil, fmt.Errorf("unable to load data from file %s: %w", filePath, err)
 	}
 
 	return &impl{
 		table: data,
-	}
+	}, nil
 }
 
-func load(_ *slog.Logger, file io.Reader) (map[string]*Lookup, error) {
+// load reads a semicolon separated file with a header row. Columns are resolved by name and every
+// row is validated, so that all problems in a file are reported at once with their line numbers.
+func load(file io.Reader) (map[string]*Lookup, error) {
 	r := csv.NewReader(file)
 	r.Comma = ';'
+	r.FieldsPerRecord = -1
 
-	refs, err := r.ReadAll()
+	header, err := r.Read()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read csv data from file: %s", err.Error())
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for idx, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = idx
+	}
+
+	if _, ok := columns[ServiceGuidenIdColumn]; !ok {
+		return nil, fmt.Errorf("line 1: missing column %s", ServiceGuidenIdColumn)
+	}
+
+	field := func(row []string, name string) string {
+		if idx, ok := columns[name]; ok {
+			return strings.TrimSpace(row[idx])
+		}
+		return ""
 	}
 
 	data := map[string]*Lookup{}
+	lines := map[string]int{}
+	errs := []error{}
+
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read csv data: %w", err)
+		}
 
-	for idx, r := range refs {
-		if idx == 0 {
+		line, _ := r.FieldPos(0)
+
+		if len(row) != len(header) {
+			errs = append(errs, fmt.Errorf("line %d: expected %d columns but found %d", line, len(header), len(row)))
 			continue
 		}
 
 		l := &Lookup{
-			ServiceGuidenId: r[1],
-			NutsCode:        r[2],
-			DeviceId:        r[3],
+			ServiceGuidenId: field(row, ServiceGuidenIdColumn),
+			NutsCode:        field(row, NutsCodeColumn),
+			DeviceId:        field(row, DeviceIdColumn),
+		}
+
+		if l.ServiceGuidenId == "" {
+			errs = append(errs, fmt.Errorf("line %d: empty %s", line, ServiceGuidenIdColumn))
+			continue
+		}
+
+		if first, ok := lines[l.ServiceGuidenId]; ok {
+			errs = append(errs, fmt.Errorf("line %d: duplicate %s %s, first seen on line %d", line, ServiceGuidenIdColumn, l.ServiceGuidenId, first))
+			continue
+		}
+		lines[l.ServiceGuidenId] = line
+
+		if l.NutsCode != "" && !nutsCodePattern.MatchString(l.NutsCode) {
+			errs = append(errs, fmt.Errorf("line %d: malformed %s %q", line, NutsCodeColumn, l.NutsCode))
+			continue
 		}
 
 		data[l.ServiceGuidenId] = l
 	}
 
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
 	return data, nil
 }
 
@@ -90,6 +144,9 @@ func (l impl) GetNutsCode(serviceGuidenId string) (string, bool) {
 
 func (l impl) GetDeviceId(serviceGuidenId string) (string, bool) {
 	if v, ok := l.table[serviceGuidenId]; ok {
+		if v.DeviceId == "" {
+			return "", false
+		}
 		return v.DeviceId, true
 	}
 
@@ -0,0 +1,66 @@
+package lookup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestNew(t *testing.T) {
+	is := is.New(t)
+
+	table, err := New("../../../../assets/config/lookup.csv")
+	is.NoErr(err)
+
+	nutsCode, ok := table.GetNutsCode("61e0a244cfc4d247cca95f4e")
+	is.True(ok)
+	is.Equal("SE0A21480000000532", nutsCode)
+
+	_, ok = table.GetNutsCode("61e0a239cfc4d247cca957bf")
+	is.True(!ok) // Allmänna badet has no nuts code
+}
+
+func TestNewReturnsErrorIfFileIsMissing(t *testing.T) {
+	is := is.New(t)
+
+	_, err := New("does-not-exist.csv")
+	is.True(err != nil)
+}
+
+func TestLoadResolvesColumnsByName(t *testing.T) {
+	is := is.New(t)
+
+	data, err := load(strings.NewReader("device_id;serviceguiden_id;name;nuts_code\nsensor-1;61e0a244cfc4d247cca95f4e;Askimsbadet;SE0A21480000000532\n"))
+	is.NoErr(err)
+
+	is.Equal("SE0A21480000000532", data["61e0a244cfc4d247cca95f4e"].NutsCode)
+	is.Equal("sensor-1", data["61e0a244cfc4d247cca95f4e"].DeviceId)
+}
+
+func TestLoadReportsLineNumbers(t *testing.T) {
+	is := is.New(t)
+
+	csv := "name;serviceguiden_id;nuts_code;device_id\n" +
+		"Askimsbadet;61e0a244cfc4d247cca95f4e;SE0A21480000000532;\n" +
+		"Short row;61e0a246cfc4d247cca9604c\n" +
+		"Duplicate;61e0a244cfc4d247cca95f4e;;\n" +
+		"Malformed;61e0a252cfc4d247cca9698b;SE0A2148;\n" +
+		"Empty id;;;\n"
+
+	_, err := load(strings.NewReader(csv))
+	is.True(err != nil)
+
+	msg := err.Error()
+	is.True(strings.Contains(msg, "line 3: expected 4 columns but found 2"))
+	is.True(strings.Contains(msg, "line 4: duplicate serviceguiden_id 61e0a244cfc4d247cca95f4e, first seen on line 2"))
+	is.True(strings.Contains(msg, `line 5: malformed nuts_code "SE0A2148"`))
+	is.True(strings.Contains(msg, "line 6: empty serviceguiden_id"))
+}
+
+func TestLoadRequiresServiceGuidenIdColumn(t *testing.T) {
+	is := is.New(t)
+
+	_, err := load(strings.NewReader("name;nuts_code\nAskimsbadet;SE0A21480000000532\n"))
+	is.True(err != nil)
+}
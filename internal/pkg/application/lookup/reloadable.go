@@ -0,0 +1,142 @@
+package lookup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+)
+
+// Reloadable is a LookupTable that reloads its file when it changes. A new table replaces the
+// current one only if it is valid, otherwise the last good table is kept.
+type Reloadable struct {
+	filePath string
+	current  atomic.Pointer[snapshot]
+	mu       sync.Mutex
+	lastErr  error
+	// rejected is the file that failed validation, so that it is not loaded again until it changes
+	rejected os.FileInfo
+}
+
+type snapshot struct {
+	table      *impl
+	generation uint64
+	loadedAt   time.Time
+	modTime    time.Time
+	size       int64
+}
+
+// NewReloadable loads the table from a file. Like New, it fails if the file is missing or invalid.
+func NewReloadable(filePath string) (*Reloadable, error) {
+	r := &Reloadable{filePath: filePath}
+
+	_, err := r.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Reloadable) GetNutsCode(serviceGuidenId string) (string, bool) {
+	return r.current.Load().table.GetNutsCode(serviceGuidenId)
+}
+
+func (r *Reloadable) GetDeviceId(serviceGuidenId string) (string, bool) {
+	return r.current.Load().table.GetDeviceId(serviceGuidenId)
+}
+
+// Generation returns the number of times a table has been loaded, starting at 1
+func (r *Reloadable) Generation() uint64 {
+	return r.current.Load().generation
+}
+
+// LoadedAt returns the time when the current table was loaded
+func (r *Reloadable) LoadedAt() time.Time {
+	return r.current.Load().loadedAt
+}
+
+// LastError returns the error from the latest reload, or nil if it succeeded
+func (r *Reloadable) LastError() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.lastErr
+}
+
+// Reload loads the file if it has changed since the current table was loaded and reports whether the table
+// was replaced. A file that fails validation is reported once and then ignored until it changes again.
+func (r *Reloadable) Reload() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fi, err := os.Stat(r.filePath)
+	if err != nil {
+		r.lastErr = fmt.Errorf("unable to stat file %s: %w", r.filePath, err)
+		return false, r.lastErr
+	}
+
+	current := r.current.Load()
+	if current != nil && fi.ModTime().Equal(current.modTime) && fi.Size() == current.size {
+		return false, nil
+	}
+
+	if r.rejected != nil && fi.ModTime().Equal(r.rejected.ModTime()) && fi.Size() == r.rejected.Size() {
+		return false, nil
+	}
+
+	table, err := New(r.filePath)
+	if err != nil {
+		r.lastErr = err
+		r.rejected = fi
+		return false, err
+	}
+
+	next := &snapshot{
+		table:      table.(*impl),
+		generation: 1,
+		loadedAt:   time.Now().UTC(),
+		modTime:    fi.ModTime(),
+		size:       fi.Size(),
+	}
+
+	if current != nil {
+		next.generation = current.generation + 1
+	}
+
+	r.current.Store(next)
+	r.lastErr = nil
+	r.rejected = nil
+
+	return true, nil
+}
+
+// Watch polls the file for changes until the context is cancelled
+func (r *Reloadable) Watch(ctx context.Context, interval time.Duration) {
+	logger := logging.GetFromContext(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				logger.Error("failed to reload lookup table, keeping the last good table", slog.String("file", r.filePath), slog.Uint64("generation", r.Generation()), "err", err.Error())
+				continue
+			}
+
+			if reloaded {
+				logger.Info("lookup table reloaded", slog.String("file", r.filePath), slog.Uint64("generation", r.Generation()))
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package lookup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestReloadSwapsTableWhenFileChanges(t *testing.T) {
+	is := is.New(t)
+
+	filePath := filepath.Join(t.TempDir(), "lookup.csv")
+	writeLookup(t, filePath, "serviceguiden_id;nuts_code\n61e0a244cfc4d247cca95f4e;SE0A21480000000532\n", time.Now().Add(-time.Minute))
+
+	table, err := NewReloadable(filePath)
+	is.NoErr(err)
+	is.Equal(uint64(1), table.Generation())
+
+	reloaded, err := table.Reload()
+	is.NoErr(err)
+	is.True(!reloaded) // the file has not changed
+
+	writeLookup(t, filePath, "serviceguiden_id;nuts_code\n61e0a244cfc4d247cca95f4e;SE0A21480000000533\n", time.Now())
+
+	reloaded, err = table.Reload()
+	is.NoErr(err)
+	is.True(reloaded)
+	is.Equal(uint64(2), table.Generation())
+
+	nutsCode, _ := table.GetNutsCode("61e0a244cfc4d247cca95f4e")
+	is.Equal("SE0A21480000000533", nutsCode)
+}
+
+func TestReloadKeepsLastGoodTable(t *testing.T) {
+	is := is.New(t)
+
+	filePath := filepath.Join(t.TempDir(), "lookup.csv")
+	writeLookup(t, filePath, "serviceguiden_id;nuts_code\n61e0a244cfc4d247cca95f4e;SE0A21480000000532\n", time.Now().Add(-time.Minute))
+
+	table, err := NewReloadable(filePath)
+	is.NoErr(err)
+	loadedAt := table.LoadedAt()
+
+	writeLookup(t, filePath, "serviceguiden_id;nuts_code\n61e0a244cfc4d247cca95f4e;invalid\n", time.Now())
+
+	reloaded, err := table.Reload()
+	is.True(err != nil)
+	is.True(!reloaded)
+	is.True(table.LastError() != nil)
+
+	reloaded, err = table.Reload()
+	is.NoErr(err) // the invalid file is only reported once
+	is.True(!reloaded)
+
+	is.Equal(uint64(1), table.Generation())
+	is.Equal(loadedAt, table.LoadedAt())
+
+	nutsCode, _ := table.GetNutsCode("61e0a244cfc4d247cca95f4e")
+	is.Equal("SE0A21480000000532", nutsCode)
+}
+
+func writeLookup(t *testing.T, filePath, contents string, modTime time.Time) {
+	err := os.WriteFile(filePath, []byte(contents), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chtimes(filePath, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
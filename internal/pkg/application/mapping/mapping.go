@@ -0,0 +1,110 @@
+package mapping
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/diwise/context-broker/pkg/datamodels/fiware"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/attributes"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/serviceguiden"
+	"gopkg.in/yaml.v3"
+)
+
+// ServiceType describes how sites of a ServiceGuiden service type are published as NGSI-LD entities
+type ServiceType struct {
+	ServiceType string `yaml:"serviceType"`
+	EntityType  string `yaml:"entityType"`
+	IDPrefix    string `yaml:"idPrefix"`
+	// Attributes is a file with attribute mappings, relative to the mapping file
+	Attributes string   `yaml:"attributes"`
+	Category   []string `yaml:"category"`
+
+	Mapper attributes.Mapper `yaml:"-"`
+}
+
+type config struct {
+	Mappings []ServiceType `yaml:"mappings"`
+}
+
+// Default returns the mapping for beaches that is used when there is no mapping file
+func Default(mapper attributes.Mapper) []ServiceType {
+	return []ServiceType{
+		{
+			ServiceType: serviceguiden.BadplatserServiceType,
+			EntityType:  fiware.BeachTypeName,
+			IDPrefix:    fiware.BeachIDPrefix,
+			Mapper:      mapper,
+		},
+	}
+}
+
+// Load reads service type mappings from a yaml file and loads the attribute mappings that each of them refer to
+func Load(filePath string) ([]ServiceType, error) {
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read file %s: %w", filePath, err)
+	}
+
+	var cfg config
+	err = yaml.Unmarshal(b, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse file %s: %w", filePath, err)
+	}
+
+	if len(cfg.Mappings) == 0 {
+		return nil, fmt.Errorf("no mappings found in %s", filePath)
+	}
+
+	seen := map[string]bool{}
+	// entityTypes is the entity type of each id prefix, since sites of service types with the same id prefix are merged into one entity
+	entityTypes := map[string]string{}
+
+	for idx := range cfg.Mappings {
+		m := &cfg.Mappings[idx]
+
+		if m.ServiceType == "" || m.EntityType == "" {
+			return nil, fmt.Errorf("mapping %d: serviceType and entityType must not be empty", idx+1)
+		}
+
+		// ServiceGuiden service types are matched regardless of case
+		if seen[strings.ToLower(m.ServiceType)] {
+			return nil, fmt.Errorf("mapping %d: duplicate mapping for service type %s", idx+1, m.ServiceType)
+		}
+		seen[strings.ToLower(m.ServiceType)] = true
+
+		if m.IDPrefix == "" {
+			m.IDPrefix = fmt.Sprintf("urn:ngsi-ld:%s:", m.EntityType)
+		}
+
+		if !strings.HasSuffix(m.IDPrefix, ":") {
+			return nil, fmt.Errorf("mapping %d: idPrefix %q must end with a colon", idx+1, m.IDPrefix)
+		}
+
+		if entityType, ok := entityTypes[m.IDPrefix]; ok && entityType != m.EntityType {
+			return nil, fmt.Errorf("mapping %d: idPrefix %q is already used for entity type %s", idx+1, m.IDPrefix, entityType)
+		}
+		entityTypes[m.IDPrefix] = m.EntityType
+
+		m.Mapper = attributes.New(nil)
+
+		if m.Attributes != "" {
+			attributesFilePath := m.Attributes
+			if !filepath.IsAbs(attributesFilePath) {
+				attributesFilePath = filepath.Join(filepath.Dir(filePath), attributesFilePath)
+			}
+
+			if _, err := os.Stat(attributesFilePath); err != nil {
+				return nil, fmt.Errorf("mapping %d: attribute mappings %s not found", idx+1, attributesFilePath)
+			}
+
+			m.Mapper, err = attributes.Load(attributesFilePath)
+			if err != nil {
+				return nil, fmt.Errorf("mapping %d: %w", idx+1, err)
+			}
+		}
+	}
+
+	return cfg.Mappings, nil
+}
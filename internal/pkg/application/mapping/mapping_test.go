@@ -0,0 +1,64 @@
+package mapping
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestLoad(t *testing.T) {
+	is := is.New(t)
+
+	mappings, err := Load("../../../../assets/config/mappings.yaml")
+	is.NoErr(err)
+
+	is.Equal("Badplatser", mappings[0].ServiceType)
+	is.Equal("Beach", mappings[0].EntityType)
+	is.Equal("urn:ngsi-ld:Beach:", mappings[0].IDPrefix)
+
+	for _, m := range mappings {
+		is.True(m.Mapper != nil)
+	}
+
+	_, unmapped := mappings[0].Mapper.Map(map[string][]string{"Toalett": {"Toalett öppen året runt"}})
+	is.Equal(0, len(unmapped))
+}
+
+func TestLoadDefaultsIDPrefix(t *testing.T) {
+	is := is.New(t)
+
+	mappings, err := Load(writeFile(t, "mappings:\n  - serviceType: Utegym\n    entityType: SportsField\n"))
+	is.NoErr(err)
+
+	is.Equal("urn:ngsi-ld:SportsField:", mappings[0].IDPrefix)
+}
+
+func TestLoadRejectsInvalidMappings(t *testing.T) {
+	is := is.New(t)
+
+	_, err := Load(writeFile(t, "mappings:\n  - serviceType: Utegym\n"))
+	is.True(err != nil) // entityType is missing
+
+	_, err = Load(writeFile(t, "mappings:\n  - serviceType: Utegym\n    entityType: SportsField\n  - serviceType: utegym\n    entityType: SportsField\n"))
+	is.True(err != nil) // service types are compared regardless of case
+
+	_, err = Load(writeFile(t, "mappings:\n  - serviceType: Utegym\n    entityType: SportsField\n  - serviceType: Utegym\n    entityType: SportsVenue\n"))
+	is.True(err != nil) // duplicate service type
+
+	_, err = Load(writeFile(t, "mappings:\n  - serviceType: Utegym\n    entityType: SportsField\n    idPrefix: \"urn:ngsi-ld:Site:\"\n  - serviceType: Sporthallar\n    entityType: SportsVenue\n    idPrefix: \"urn:ngsi-ld:Site:\"\n"))
+	is.True(err != nil) // entities with the same id must have the same type
+
+	_, err = Load(writeFile(t, "mappings:\n  - serviceType: Utegym\n    entityType: SportsField\n    attributes: missing.csv\n"))
+	is.True(err != nil)
+}
+
+func writeFile(t *testing.T, contents string) string {
+	filePath := filepath.Join(t.TempDir(), "mappings.yaml")
+	err := os.WriteFile(filePath, []byte(contents), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
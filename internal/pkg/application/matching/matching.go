@@ -0,0 +1,180 @@
+package matching
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/geometry"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/hav"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/serviceguiden"
+)
+
+// Candidate is a proposed NUTS code for a ServiceGuiden site
+type Candidate struct {
+	ServiceGuidenID string  `json:"serviceguidenId"`
+	Name            string  `json:"name"`
+	NutsCode        string  `json:"nutsCode"`
+	BathingSiteName string  `json:"bathingSiteName"`
+	Distance        float64 `json:"distance"`
+	NameSimilarity  float64 `json:"nameSimilarity"`
+	Confidence      float64 `json:"confidence"`
+}
+
+type Options struct {
+	// MaxDistance in metres, bathing sites further away are never proposed
+	MaxDistance float64
+	// MinConfidence is the lowest confidence, between 0 and 1, for a candidate to be proposed
+	MinConfidence float64
+	// DistanceWeight is the share of the confidence that comes from the distance, the rest comes from name similarity
+	DistanceWeight float64
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MaxDistance:    1000,
+		MinConfidence:  0.5,
+		DistanceWeight: 0.6,
+	}
+}
+
+// Match returns the bathing sites that may be the same as a ServiceGuiden site, with the most likely candidate first
+func Match(site serviceguiden.Site, bathingSites []hav.BathingSite, opts Options) []Candidate {
+	candidates := []Candidate{}
+
+	pos := site.Position()
+
+	for _, bs := range bathingSites {
+		distance := geometry.Distance(pos.Latitude, pos.Longitude, bs.Latitude, bs.Longitude)
+		if distance > opts.MaxDistance {
+			continue
+		}
+
+		similarity := Similarity(site.Name(), bs.Name)
+		confidence := opts.DistanceWeight*(1-distance/opts.MaxDistance) + (1-opts.DistanceWeight)*similarity
+
+		if confidence < opts.MinConfidence {
+			continue
+		}
+
+		candidates = append(candidates, Candidate{
+			ServiceGuidenID: site.ID(),
+			Name:            site.Name(),
+			NutsCode:        bs.NutsCode,
+			BathingSiteName: bs.Name,
+			Distance:        distance,
+			NameSimilarity:  similarity,
+			Confidence:      confidence,
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Confidence > candidates[j].Confidence
+	})
+
+	return candidates
+}
+
+// Similarity compares two names and returns a value between 0 and 1, where 1 means that the names are the same.
+// Names are compared both as a whole and word by word, so that "Aspholmen (Saltholmen)" is similar to "Saltholmen".
+func Similarity(a, b string) float64 {
+	wordsA := words(a)
+	wordsB := words(b)
+
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return 0
+	}
+
+	whole := ratio(strings.Join(wordsA, " "), strings.Join(wordsB, " "))
+
+	// the average of the best match for each word in the shorter name
+	if len(wordsA) > len(wordsB) {
+		wordsA, wordsB = wordsB, wordsA
+	}
+
+	sum := 0.0
+	for _, wa := range wordsA {
+		best := 0.0
+		for _, wb := range wordsB {
+			best = max(best, ratio(wa, wb))
+		}
+		sum += best
+	}
+
+	return max(whole, sum/float64(len(wordsA)))
+}
+
+func words(name string) []string {
+	return strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// ratio returns 1 minus the Levenshtein distance divided by the length of the longest string
+func ratio(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// WriteCSV writes candidates in the same format as the lookup table, with extra columns for review.
+// Device ids are taken from deviceID so that existing references are kept.
+func WriteCSV(w io.Writer, candidates []Candidate, deviceID func(serviceGuidenID string) string) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+
+	err := cw.Write([]string{"name", "serviceguiden_id", "nuts_code", "device_id", "bathing_site_name", "distance", "name_similarity", "confidence"})
+	if err != nil {
+		return err
+	}
+
+	for _, c := range candidates {
+		err = cw.Write([]string{
+			c.Name,
+			c.ServiceGuidenID,
+			c.NutsCode,
+			deviceID(c.ServiceGuidenID),
+			c.BathingSiteName,
+			fmt.Sprintf("%.0f", c.Distance),
+			fmt.Sprintf("%.2f", c.NameSimilarity),
+			fmt.Sprintf("%.2f", c.Confidence),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,62 @@
+package matching
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/hav"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/serviceguiden"
+	"github.com/matryer/is"
+)
+
+func TestMatchPrefersCloseSitesWithSimilarNames(t *testing.T) {
+	is := is.New(t)
+
+	askim := serviceguiden.Content{
+		ID_:       "61e0a244cfc4d247cca95f4e",
+		Name_:     "Askimsbadet",
+		Position_: serviceguiden.Position{Latitude: 57.62595719307582, Longitude: 11.92624964921406},
+	}
+
+	bathingSites := []hav.BathingSite{
+		{NutsCode: "SE0A21480000000531", Name: "Hovåsbadet", Latitude: 57.6245, Longitude: 11.9275},
+		{NutsCode: "SE0A21480000000532", Name: "Askim badplats", Latitude: 57.6262, Longitude: 11.9259},
+		{NutsCode: "SE0A21480000000388", Name: "Askimsbadet", Latitude: 57.7800, Longitude: 12.0500},
+	}
+
+	candidates := Match(askim, bathingSites, DefaultOptions())
+
+	is.True(len(candidates) > 0)
+	is.Equal("SE0A21480000000532", candidates[0].NutsCode)
+	is.True(candidates[0].Distance < 50)
+
+	for _, c := range candidates {
+		is.True(c.NutsCode != "SE0A21480000000388") // too far away, even if the name is the same
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(1.0, Similarity("Askimsbadet", "askimsbadet"))
+	is.Equal(1.0, Similarity("Aspholmen (Saltholmen)", "Saltholmen"))
+	is.True(Similarity("Askimsbadet", "Askim badplats") > Similarity("Askimsbadet", "Hovåsbadet"))
+	is.Equal(0.0, Similarity("", "Askimsbadet"))
+}
+
+func TestWriteCSVCanBeUsedAsLookupTable(t *testing.T) {
+	is := is.New(t)
+
+	candidates := []Candidate{
+		{ServiceGuidenID: "61e0a244cfc4d247cca95f4e", Name: "Askimsbadet", NutsCode: "SE0A21480000000532", BathingSiteName: "Askim badplats", Distance: 42.4, NameSimilarity: 0.8, Confidence: 0.9},
+	}
+
+	var buf bytes.Buffer
+	err := WriteCSV(&buf, candidates, func(string) string { return "sensor-1" })
+	is.NoErr(err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	is.Equal("name;serviceguiden_id;nuts_code;device_id;bathing_site_name;distance;name_similarity;confidence", lines[0])
+	is.Equal("Askimsbadet;61e0a244cfc4d247cca95f4e;SE0A21480000000532;sensor-1;Askim badplats;42;0.80;0.90", lines[1])
+}
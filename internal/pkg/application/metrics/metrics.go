@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/health"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/report"
+)
+
+const (
+	NutsCode string = "nuts_code"
+	DeviceID string = "device_id"
+)
+
+type instruments struct {
+	sitesFetched          metric.Int64Counter
+	entities              metric.Int64Counter
+	lookups               metric.Int64Counter
+	serviceGuidenDuration metric.Float64Histogram
+	contextBrokerDuration metric.Float64Histogram
+}
+
+var instr instruments
+
+// lastSuccess is the unix time of the last successful run, or zero if no run has succeeded yet
+var lastSuccess atomic.Int64
+
+func init() {
+	// instruments created from the global meter are delegated to the meter provider that o11y sets up later
+	err := use(otel.Meter("integration-cip-gbg-ms/metrics"))
+	if err != nil {
+		otel.Handle(err)
+	}
+}
+
+func use(meter metric.Meter) error {
+	var err error
+	var i instruments
+
+	newCounter := func(name, desc string) metric.Int64Counter {
+		c, e := meter.Int64Counter(name, metric.WithDescription(desc))
+		if e != nil {
+			err = e
+		}
+		return c
+	}
+
+	newHistogram := func(name, desc string) metric.Float64Histogram {
+		h, e := meter.Float64Histogram(name, metric.WithDescription(desc), metric.WithUnit("s"))
+		if e != nil {
+			err = e
+		}
+		return h
+	}
+
+	i.sitesFetched = newCounter("sync.sites.fetched", "Number of sites fetched from ServiceGuiden")
+	i.entities = newCounter("sync.entities", "Number of synced entities by outcome")
+	i.lookups = newCounter("sync.lookups", "Number of lookups of NUTS codes and device ids by result")
+	i.serviceGuidenDuration = newHistogram("serviceguiden.request.duration", "Duration of requests to ServiceGuiden")
+	i.contextBrokerDuration = newHistogram("contextbroker.request.duration", "Duration of requests to the context broker")
+
+	_, e := meter.Int64ObservableGauge("sync.last_success",
+		metric.WithDescription("Unix time of the last successful sync"),
+		metric.WithUnit("s"),
+		metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+			if t := lastSuccess.Load(); t > 0 {
+				o.Observe(t)
+			}
+			return nil
+		}))
+	if e != nil {
+		err = e
+	}
+
+	instr = i
+
+	return err
+}
+
+// SitesFetched counts the sites of a service type that were fetched from ServiceGuiden
+func SitesFetched(ctx context.Context, serviceType string, count int) {
+	instr.sitesFetched.Add(ctx, int64(count), metric.WithAttributes(attribute.String("service_type", serviceType)))
+}
+
+// Lookup counts a lookup of a NUTS code or device id in the lookup table as a hit or a miss
+func Lookup(ctx context.Context, kind string, found bool) {
+	result := "miss"
+	if found {
+		result = "hit"
+	}
+	instr.lookups.Add(ctx, 1, metric.WithAttributes(attribute.String("kind", kind), attribute.String("result", result)))
+}
+
+// ServiceGuidenRequest records the duration of a request to ServiceGuiden that started at start
+func ServiceGuidenRequest(ctx context.Context, start time.Time, err error) {
+	instr.serviceGuidenDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attribute.Bool("error", err != nil)))
+}
+
+// ContextBrokerRequest records the duration of a request to the context broker that started at start
+func ContextBrokerRequest(ctx context.Context, operation string, start time.Time, err error) {
+	instr.contextBrokerDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attribute.String("operation", operation), attribute.Bool("error", err != nil)))
+}
+
+// EntitiesSynced counts the outcome of each entity in the report of a run
+func EntitiesSynced(ctx context.Context, rpt *report.Report) {
+	for _, e := range rpt.Entities {
+		if e.Outcome == "" {
+			continue
+		}
+		instr.entities.Add(ctx, 1, metric.WithAttributes(attribute.String("entity_type", e.Type), attribute.String("outcome", e.Outcome)))
+	}
+}
+
+// RunSucceeded records the time a sync of all sites finished without errors
+func RunSucceeded(t time.Time) {
+	lastSuccess.Store(t.Unix())
+}
+
+// LastSuccess returns the time of the last successful run, or the zero time if no run has succeeded yet
+func LastSuccess() time.Time {
+	t := lastSuccess.Load()
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(t, 0)
+}
+
+type contextBrokerClient struct {
+	client.ContextBrokerClient
+}
+
+// InstrumentContextBroker records the duration of each request made with c, and whether the context
+// broker was reachable
+func InstrumentContextBroker(c client.ContextBrokerClient) client.ContextBrokerClient {
+	return &contextBrokerClient{ContextBrokerClient: c}
+}
+
+func observe(ctx context.Context, operation string, start time.Time, err error) {
+	ContextBrokerRequest(ctx, operation, start, err)
+	health.ContextBroker.Attempt(health.BrokerUnreachable(err))
+}
+
+func (c *contextBrokerClient) CreateEntity(ctx context.Context, entity types.Entity, headers map[string][]string) (result *ngsild.CreateEntityResult, err error) {
+	defer func(start time.Time) { observe(ctx, "create", start, err) }(time.Now())
+	return c.ContextBrokerClient.CreateEntity(ctx, entity, headers)
+}
+
+func (c *contextBrokerClient) QueryEntities(ctx context.Context, entityTypes, entityAttributes []string, query string, headers map[string][]string) (result *ngsild.QueryEntitiesResult, err error) {
+	defer func(start time.Time) { observe(ctx, "query", start, err) }(time.Now())
+	return c.ContextBrokerClient.QueryEntities(ctx, entityTypes, entityAttributes, query, headers)
+}
+
+func (c *contextBrokerClient) RetrieveEntity(ctx context.Context, entityID string, headers map[string][]string) (result types.Entity, err error) {
+	defer func(start time.Time) { observe(ctx, "retrieve", start, err) }(time.Now())
+	return c.ContextBrokerClient.RetrieveEntity(ctx, entityID, headers)
+}
+
+func (c *contextBrokerClient) MergeEntity(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (result *ngsild.MergeEntityResult, err error) {
+	defer func(start time.Time) { observe(ctx, "merge", start, err) }(time.Now())
+	return c.ContextBrokerClient.MergeEntity(ctx, entityID, fragment, headers)
+}
+
+func (c *contextBrokerClient) DeleteEntity(ctx context.Context, entityID string) (result *ngsild.DeleteEntityResult, err error) {
+	defer func(start time.Time) { observe(ctx, "delete", start, err) }(time.Now())
+	return c.ContextBrokerClient.DeleteEntity(ctx, entityID)
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/report"
+)
+
+func TestEntitiesAndLookupsAreCounted(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	reader := sdkmetric.NewManualReader()
+	is.NoErr(use(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")))
+
+	rpt := report.New(false)
+	rpt.Entity("urn:ngsi-ld:Beach:1", "1").Outcome = report.Created
+	rpt.Entity("urn:ngsi-ld:Beach:2", "2").Outcome = report.Created
+	rpt.Entity("urn:ngsi-ld:Beach:3", "3").Outcome = report.Deleted
+	rpt.Finish()
+
+	EntitiesSynced(ctx, rpt)
+	RunSucceeded(rpt.FinishedAt)
+	Lookup(ctx, NutsCode, true)
+	Lookup(ctx, NutsCode, false)
+	Lookup(ctx, NutsCode, false)
+
+	rm := metricdata.ResourceMetrics{}
+	is.NoErr(reader.Collect(ctx, &rm))
+
+	is.Equal(int64(2), sum(rm, "sync.entities", attribute.String("outcome", report.Created)))
+	is.Equal(int64(1), sum(rm, "sync.entities", attribute.String("outcome", report.Deleted)))
+	is.Equal(int64(2), sum(rm, "sync.lookups", attribute.String("result", "miss")))
+	is.Equal(int64(1), sum(rm, "sync.lookups", attribute.String("result", "hit")))
+	is.Equal(rpt.FinishedAt.Unix(), gauge(rm, "sync.last_success"))
+	is.Equal(rpt.FinishedAt.Truncate(time.Second), LastSuccess().UTC())
+}
+
+func sum(rm metricdata.ResourceMetrics, name string, attr attribute.KeyValue) int64 {
+	total := int64(0)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if s, ok := m.Data.(metricdata.Sum[int64]); ok && m.Name == name {
+				for _, dp := range s.DataPoints {
+					if v, ok := dp.Attributes.Value(attr.Key); ok && v == attr.Value {
+						total += dp.Value
+					}
+				}
+			}
+		}
+	}
+	return total
+}
+
+func gauge(rm metricdata.ResourceMetrics, name string) int64 {
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if g, ok := m.Data.(metricdata.Gauge[int64]); ok && m.Name == name && len(g.DataPoints) > 0 {
+				return g.DataPoints[0].Value
+			}
+		}
+	}
+	return 0
+}
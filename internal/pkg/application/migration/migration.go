@@ -0,0 +1,263 @@
+package migration
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/diwise/context-broker/pkg/datamodels/fiware"
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/relationships"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/cip"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/mapping"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/pipeline"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/report"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/serviceguiden"
+)
+
+const (
+	// Recreate creates the entity under its new id and then deletes the entity with the old id
+	Recreate string = "recreate"
+	// DeleteOld only deletes the entity with the old id, since there already is an entity with the new id
+	DeleteOld string = "delete-old"
+)
+
+// Migration moves the entity of a ServiceGuiden site from its old id to its new id
+type Migration struct {
+	EntityType string
+	SourceID   string
+	Name       string
+	OldID      string
+	NewID      string
+	Action     string
+
+	entity types.Entity
+}
+
+// Plan finds the entities in the context broker that have the old id of a ServiceGuiden site
+func Plan(ctx context.Context, sgClient serviceguiden.ServiceGuidenClient, cbClient client.ContextBrokerClient, mappings []mapping.ServiceType) ([]Migration, error) {
+	existing := map[string]map[string]types.Entity{}
+	planned := map[string]bool{}
+	plan := []Migration{}
+
+	for _, m := range mappings {
+		sites, err := sgClient.Sites(ctx, m.ServiceType)
+		if err != nil {
+			return nil, err
+		}
+
+		byID, ok := existing[m.EntityType]
+		if !ok {
+			listed, err := cip.ListEntities(ctx, cbClient, m.EntityType)
+			if err != nil {
+				return nil, err
+			}
+
+			byID = map[string]types.Entity{}
+			for _, e := range listed {
+				byID[e.ID()] = e
+			}
+			existing[m.EntityType] = byID
+		}
+
+		for _, site := range sites {
+			oldID := pipeline.LegacyEntityID(m, site.ID())
+			newID := pipeline.EntityID(m, site.ID())
+
+			old, found := byID[oldID]
+			if !found || planned[oldID] {
+				continue
+			}
+			planned[oldID] = true
+
+			action := Recreate
+			if _, ok := byID[newID]; ok {
+				action = DeleteOld
+			}
+
+			plan = append(plan, Migration{
+				EntityType: m.EntityType,
+				SourceID:   site.ID(),
+				Name:       site.Name(),
+				OldID:      oldID,
+				NewID:      newID,
+				Action:     action,
+				entity:     old,
+			})
+		}
+	}
+
+	return plan, nil
+}
+
+// WriteCSV writes the plan with one line for each entity, so that it can be reviewed before it is applied
+func WriteCSV(w io.Writer, plan []Migration) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+
+	err := cw.Write([]string{"entity_type", "serviceguiden_id", "name", "old_id", "new_id", "action"})
+	if err != nil {
+		return err
+	}
+
+	for _, m := range plan {
+		err = cw.Write([]string{m.EntityType, m.SourceID, m.Name, m.OldID, m.NewID, m.Action})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// Apply migrates each entity in the plan and points the water quality observations of migrated beaches
+// to their new ids. An entity with the old id is only deleted once there is an entity with the new id.
+func Apply(ctx context.Context, cbClient client.ContextBrokerClient, plan []Migration, rpt *report.Report) error {
+	logger := logging.GetFromContext(ctx)
+
+	headers := map[string][]string{"Content-Type": {"application/ld+json"}}
+
+	errs := []error{}
+	migrated := map[string]string{}
+
+	for _, m := range plan {
+		entry := rpt.Entity(m.NewID, m.SourceID)
+		entry.Type = m.EntityType
+		entry.Name = m.Name
+
+		if m.Action == Recreate {
+			e, err := withID(m.entity, m.NewID)
+			if err != nil {
+				entry.Fail(err)
+				errs = append(errs, err)
+				continue
+			}
+
+			_, err = cbClient.CreateEntity(ctx, e, headers)
+			if err != nil && !errors.Is(err, ngsierrors.ErrAlreadyExists) {
+				err = fmt.Errorf("failed to create entity %s, %w", m.NewID, err)
+				logger.Error("failed to recreate entity", slog.String("entity_id", m.NewID), slog.String("old_id", m.OldID), "err", err.Error())
+				entry.Fail(err)
+				errs = append(errs, err)
+				continue
+			}
+			entry.Outcome = report.Created
+		}
+
+		_, err := cbClient.DeleteEntity(ctx, m.OldID)
+		if err != nil && !errors.Is(err, ngsierrors.ErrNotFound) {
+			err = fmt.Errorf("failed to delete entity %s, %w", m.OldID, err)
+			logger.Error("failed to delete old entity", slog.String("entity_id", m.OldID), "err", err.Error())
+			entry.Fail(err)
+			errs = append(errs, err)
+			continue
+		}
+
+		rpt.Entity(m.OldID, m.SourceID).Outcome = report.Deleted
+		migrated[m.OldID] = m.NewID
+
+		logger.Info("entity migrated", slog.String("old_id", m.OldID), slog.String("entity_id", m.NewID), slog.String("action", m.Action))
+	}
+
+	if len(migrated) > 0 {
+		err := updateReferences(ctx, cbClient, migrated, rpt)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// updateReferences points the refPointOfInterest of water quality observations from old to new ids
+func updateReferences(ctx context.Context, cbClient client.ContextBrokerClient, migrated map[string]string, rpt *report.Report) error {
+	observations, err := cip.ListEntities(ctx, cbClient, fiware.WaterQualityObservedTypeName)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string][]string{"Content-Type": {"application/ld+json"}}
+	errs := []error{}
+
+	for _, o := range observations {
+		ref, err := refPointOfInterest(o)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		newID, ok := migrated[ref]
+		if !ok {
+			continue
+		}
+
+		entry := rpt.Entity(o.ID(), "")
+		entry.Type = o.Type()
+
+		fragment, err := entities.NewFragment(entities.R("refPointOfInterest", relationships.NewSingleObjectRelationship(newID)))
+		if err == nil {
+			_, err = cbClient.MergeEntity(ctx, o.ID(), fragment, headers)
+		}
+
+		if err != nil {
+			err = fmt.Errorf("failed to update refPointOfInterest of %s, %w", o.ID(), err)
+			entry.Fail(err)
+			errs = append(errs, err)
+			continue
+		}
+
+		entry.Outcome = report.Merged
+	}
+
+	return errors.Join(errs...)
+}
+
+func withID(e types.Entity, id string) (types.Entity, error) {
+	b, err := e.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal entity %s, %w", e.ID(), err)
+	}
+
+	var m map[string]any
+	if err = json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal entity %s, %w", e.ID(), err)
+	}
+
+	m["id"] = id
+
+	b, err = json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal entity %s, %w", id, err)
+	}
+
+	return entities.NewFromJSON(b)
+}
+
+func refPointOfInterest(e types.Entity) (string, error) {
+	b, err := e.MarshalJSON()
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal entity %s, %w", e.ID(), err)
+	}
+
+	var ref struct {
+		RefPointOfInterest struct {
+			Object string `json:"object"`
+		} `json:"refPointOfInterest"`
+	}
+
+	if err = json.Unmarshal(b, &ref); err != nil {
+		return "", fmt.Errorf("failed to unmarshal entity %s, %w", e.ID(), err)
+	}
+
+	return ref.RefPointOfInterest.Object, nil
+}
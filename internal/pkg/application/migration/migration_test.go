@@ -0,0 +1,117 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+	"github.com/diwise/context-broker/pkg/ngsild/types/relationships"
+	test "github.com/diwise/context-broker/pkg/test"
+	"github.com/matryer/is"
+
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/mapping"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/pipeline"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/report"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/serviceguiden"
+)
+
+func TestMigrate(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	beach := mapping.Default(nil)[0]
+
+	askim := serviceguiden.Content{ID_: "61e0a244cfc4d247cca95f4e", Name_: "Askimsbadet"}
+	bergsjon := serviceguiden.Content{ID_: "61e0a252cfc4d247cca9698b", Name_: "Bergsjön"}
+	aspholmen := serviceguiden.Content{ID_: "61e0a246cfc4d247cca9604c", Name_: "Aspholmen"}
+
+	askimOld, _ := entities.New(pipeline.LegacyEntityID(beach, askim.ID()), "Beach", decorators.Name("Askimsbadet"))
+	bergsjonOld, _ := entities.New(pipeline.LegacyEntityID(beach, bergsjon.ID()), "Beach", decorators.Name("Bergsjön"))
+	bergsjonNew, _ := entities.New(pipeline.EntityID(beach, bergsjon.ID()), "Beach", decorators.Name("Bergsjön"))
+	aspholmenNew, _ := entities.New(pipeline.EntityID(beach, aspholmen.ID()), "Beach", decorators.Name("Aspholmen"))
+
+	observation, _ := entities.New("urn:ngsi-ld:WaterQualityObserved:SE0A21480000000001:20240708T080000Z", "WaterQualityObserved",
+		entities.R("refPointOfInterest", relationships.NewSingleObjectRelationship(askimOld.ID())))
+
+	cbClient := &test.ContextBrokerClientMock{
+		QueryEntitiesFunc: func(ctx context.Context, entityTypes, entityAttributes []string, query string, headers map[string][]string) (*ngsild.QueryEntitiesResult, error) {
+			found := []types.Entity{askimOld, bergsjonOld, bergsjonNew, aspholmenNew}
+			if entityTypes[0] == "WaterQualityObserved" {
+				found = []types.Entity{observation}
+			}
+
+			qer := ngsild.NewQueryEntitiesResult()
+			go func() {
+				for _, e := range found {
+					qer.Found <- e
+				}
+				qer.Found <- nil
+			}()
+			return qer, nil
+		},
+		CreateEntityFunc: func(ctx context.Context, entity types.Entity, headers map[string][]string) (*ngsild.CreateEntityResult, error) {
+			return &ngsild.CreateEntityResult{}, nil
+		},
+		DeleteEntityFunc: func(ctx context.Context, entityID string) (*ngsild.DeleteEntityResult, error) {
+			return &ngsild.DeleteEntityResult{}, nil
+		},
+		MergeEntityFunc: func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+			return &ngsild.MergeEntityResult{}, nil
+		},
+	}
+
+	sgClient := &sgClientMock{beaches: []serviceguiden.Site{askim, bergsjon, aspholmen}}
+
+	plan, err := Plan(ctx, sgClient, cbClient, []mapping.ServiceType{beach})
+	is.NoErr(err)
+	is.Equal(2, len(plan)) // aspholmen already has its new id
+
+	is.Equal(Recreate, plan[0].Action)
+	is.Equal(DeleteOld, plan[1].Action)
+
+	buf := &bytes.Buffer{}
+	is.NoErr(WriteCSV(buf, plan))
+	is.True(strings.Contains(buf.String(), "Beach;61e0a244cfc4d247cca95f4e;Askimsbadet;"+askimOld.ID()+";"+pipeline.EntityID(beach, askim.ID())+";recreate\n"))
+
+	is.Equal(0, len(cbClient.CreateEntityCalls())) // nothing is written while planning
+
+	rpt := report.New(false)
+	is.NoErr(Apply(ctx, cbClient, plan, rpt))
+
+	is.Equal(1, len(cbClient.CreateEntityCalls()))
+	created := cbClient.CreateEntityCalls()[0].Entity
+	is.Equal(pipeline.EntityID(beach, askim.ID()), created.ID())
+
+	b, _ := created.MarshalJSON()
+	is.True(strings.Contains(string(b), `"Askimsbadet"`))
+
+	is.Equal(2, len(cbClient.DeleteEntityCalls()))
+	is.Equal(askimOld.ID(), cbClient.DeleteEntityCalls()[0].EntityID)
+	is.Equal(bergsjonOld.ID(), cbClient.DeleteEntityCalls()[1].EntityID)
+
+	is.Equal(1, len(cbClient.MergeEntityCalls()))
+	is.Equal(observation.ID(), cbClient.MergeEntityCalls()[0].EntityID)
+
+	b, _ = cbClient.MergeEntityCalls()[0].Fragment.MarshalJSON()
+	is.True(strings.Contains(string(b), pipeline.EntityID(beach, askim.ID())))
+}
+
+type sgClientMock struct {
+	beaches []serviceguiden.Site
+}
+
+func (m *sgClientMock) Badplatser(ctx context.Context) ([]serviceguiden.Beach, error) {
+	return nil, nil
+}
+
+func (m *sgClientMock) Sites(ctx context.Context, serviceType string) ([]serviceguiden.Site, error) {
+	if serviceType == serviceguiden.BadplatserServiceType {
+		return m.beaches, nil
+	}
+	return nil, nil
+}
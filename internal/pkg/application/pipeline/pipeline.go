@@ -0,0 +1,732 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/datamodels/fiware"
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/google/uuid"
+
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/advisory"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/cip"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/geometry"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/hav"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/health"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/lookup"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/mapping"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/metrics"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/report"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/retry"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/serviceguiden"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/waterquality"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+)
+
+type Config struct {
+	LookupTable lookup.LookupTable
+	Geometries  geometry.Source
+	// Mappings decide which ServiceGuiden service types are synced and how they are published
+	Mappings []mapping.ServiceType
+	// Advisories extracts notices, such as bathing advisories, from the descriptions of sites
+	Advisories advisory.Extractor
+	// Descriptions decide in which formats the descriptions of sites are published
+	Descriptions cip.Descriptions
+	CBClient     client.ContextBrokerClient
+	Reconcile    cip.ReconcileOptions
+	// DryRun compares each entity with the context broker and reports the differences instead of writing them
+	DryRun bool
+	// BatchClient is used to upsert entities in chunks of BatchSize. Each entity is merged or created
+	// on its own if BatchSize is zero or if a chunk fails as a whole.
+	BatchClient cip.BatchClient
+	BatchSize   int
+	// Concurrency is the number of sites, or batches, that are synced at the same time
+	Concurrency int
+	// WaterQuality is used to publish the latest WaterQualitySamples sample results of each beach
+	// with a NUTS code. Water quality is not published if it is nil.
+	WaterQuality        hav.Client
+	WaterQualitySamples int
+	// SourceID limits a run to the site with this ServiceGuiden id. Entities are not reconciled
+	// when a run is limited to a single site.
+	SourceID string
+}
+
+var ErrSiteNotFound = errors.New("site not found in ServiceGuiden")
+
+// ErrLegacyIDs means that entities have been published with the ids of earlier versions and must be moved with migrate-ids before a sync
+var ErrLegacyIDs = errors.New("entities with legacy ids exist, run migrate-ids first")
+
+// entityTypeState keeps track of the entities of a single NGSI-LD type during a run
+type entityTypeState struct {
+	existing     []types.Entity
+	storedHashes map[string]string
+	// attributes are the names of the attributes of each existing entity
+	attributes map[string]map[string]bool
+	// listed is false if the existing entities could not be listed
+	listed     bool
+	currentIDs map[string]bool
+}
+
+// Run syncs the sites of each mapped service type from ServiceGuiden to the context broker and reports the outcome for each entity
+func Run(ctx context.Context, sgClient serviceguiden.ServiceGuidenClient, cfg Config) (*report.Report, error) {
+	logger := logging.GetFromContext(ctx)
+
+	rpt := report.New(cfg.DryRun)
+	defer rpt.Finish()
+
+	errs := []error{}
+	useBatch := cfg.BatchClient != nil && cfg.BatchSize > 0 && !cfg.DryRun
+
+	states := map[string]*entityTypeState{}
+	sampled := []waterquality.Beach{}
+	jobs := []siteJob{}
+	// mapped is the index of the job of each entity id
+	mapped := map[string]int{}
+
+	for _, m := range cfg.Mappings {
+		sites, err := sgClient.Sites(ctx, m.ServiceType)
+		if err != nil {
+			return rpt, err
+		}
+
+		metrics.SitesFetched(ctx, m.ServiceType, len(sites))
+
+		state, ok := states[m.EntityType]
+		if !ok {
+			state, err = listEntityType(ctx, cfg.CBClient, m.EntityType)
+			if err != nil {
+				// without knowing which entities exist, nothing can be skipped and reconciliation is not possible
+				logger.Error("failed to list existing entities", slog.String("entity_type", m.EntityType), "err", err.Error())
+				errs = append(errs, err)
+			}
+			states[m.EntityType] = state
+		}
+
+		for _, site := range sites {
+			if cfg.SourceID != "" && site.ID() != cfg.SourceID {
+				continue
+			}
+
+			entityID := EntityID(m, site.ID())
+
+			if i, ok := mapped[entityID]; ok {
+				// sites with more than one service type mapped to the same entity are published once, with the categories and attributes of each
+				logger.Debug("site already mapped", slog.String("entity_id", entityID), slog.String("service_type", m.ServiceType))
+				jobs[i].ms = append(jobs[i].ms, m)
+				continue
+			}
+
+			// entries are added in the order of the sites, so that the report does not depend on the order in which workers finish
+			entry := rpt.Entity(entityID, site.ID())
+			entry.Type = m.EntityType
+			entry.Name = site.Name()
+			state.currentIDs[entityID] = true
+
+			if m.EntityType == fiware.BeachTypeName {
+				if nutsCode, ok := cfg.LookupTable.GetNutsCode(site.ID()); ok {
+					sampled = append(sampled, waterquality.Beach{ID: entityID, NutsCode: nutsCode, Position: site.Position()})
+				}
+			}
+
+			mapped[entityID] = len(jobs)
+			jobs = append(jobs, siteJob{ms: []mapping.ServiceType{m}, state: state, site: site, entry: entry})
+		}
+	}
+
+	if cfg.SourceID != "" && len(rpt.Entities) == 0 {
+		return rpt, fmt.Errorf("%w: %s", ErrSiteNotFound, cfg.SourceID)
+	}
+
+	// a sync would publish these sites again under their current ids, and migrate-ids could then only delete the old entities
+	if legacy := legacyEntityIDs(jobs); len(legacy) > 0 {
+		logger.Error("entities with legacy ids exist, refusing to sync", slog.Int("count", len(legacy)), slog.String("entity_id", legacy[0]))
+		return rpt, fmt.Errorf("%w: %d entities, e.g. %s", ErrLegacyIDs, len(legacy), legacy[0])
+	}
+
+	pending := make([]*pendingEntity, len(jobs))
+	jobErrs := make([]error, len(jobs))
+
+	// each site is handled by a single worker, so the log messages of an entity keep their order
+	stopped := forEach(cfg.Concurrency, len(jobs), func(i int) bool {
+		j := jobs[i]
+		start := time.Now()
+
+		pending[i], jobErrs[i] = syncSite(ctx, cfg, j.ms, j.state, j.site, j.entry, useBatch)
+		j.entry.Took(start)
+
+		return errors.Is(jobErrs[i], retry.ErrCircuitOpen)
+	})
+
+	errs = append(errs, jobErrs...)
+
+	if stopped {
+		logger.Error("context broker is unavailable, stopping run")
+		return rpt, errors.Join(errs...)
+	}
+
+	chunks := [][]pendingEntity{}
+	chunk := []pendingEntity{}
+	for _, p := range pending {
+		if p == nil {
+			continue
+		}
+
+		chunk = append(chunk, *p)
+		if len(chunk) == cfg.BatchSize {
+			chunks = append(chunks, chunk)
+			chunk = []pendingEntity{}
+		}
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+
+	chunkErrs := make([]error, len(chunks))
+
+	stopped = forEach(cfg.Concurrency, len(chunks), func(i int) bool {
+		chunkErrs[i] = upsertChunk(ctx, cfg, chunks[i])
+		return errors.Is(chunkErrs[i], retry.ErrCircuitOpen)
+	})
+
+	errs = append(errs, chunkErrs...)
+
+	if stopped {
+		logger.Error("context broker is unavailable, stopping run")
+		return rpt, errors.Join(errs...)
+	}
+
+	if cfg.WaterQuality != nil {
+		err := waterquality.Sync(ctx, cfg.WaterQuality, cfg.CBClient, sampled, waterquality.Options{Samples: cfg.WaterQualitySamples, DryRun: cfg.DryRun}, rpt)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if cfg.SourceID != "" {
+		// a run for a single site knows nothing about the other sites, so nothing can be reconciled
+		return rpt, errors.Join(errs...)
+	}
+
+	reconcileOpts := cfg.Reconcile
+	reconcileOpts.DryRun = cfg.DryRun
+
+	typeNames := make([]string, 0, len(states))
+	for typeName := range states {
+		typeNames = append(typeNames, typeName)
+	}
+	sort.Strings(typeNames)
+
+	for _, typeName := range typeNames {
+		state := states[typeName]
+		if !state.listed {
+			continue
+		}
+
+		err := cip.Reconcile(ctx, cfg.CBClient, typeName, state.existing, state.currentIDs, reconcileOpts, rpt)
+		if err != nil {
+			logger.Error("failed to reconcile entities", slog.String("entity_type", typeName), "err", err.Error())
+			errs = append(errs, err)
+		}
+	}
+
+	return rpt, errors.Join(errs...)
+}
+
+// legacyEntityIDs returns the ids of existing entities that were published with the ids of earlier versions
+func legacyEntityIDs(jobs []siteJob) []string {
+	ids := []string{}
+
+	for _, j := range jobs {
+		legacyID := LegacyEntityID(j.ms[0], j.site.ID())
+		if _, ok := j.state.storedHashes[legacyID]; ok {
+			ids = append(ids, legacyID)
+		}
+	}
+
+	return ids
+}
+
+type siteJob struct {
+	// ms are the mappings of the service types of the site, which all map to the same entity
+	ms    []mapping.ServiceType
+	state *entityTypeState
+	site  serviceguiden.Site
+	entry *report.Entity
+}
+
+// forEach calls fn for each index from 0 to n-1, with at most concurrency calls running at the same time.
+// No more calls are started once a call returns true, and forEach then reports that it stopped early.
+func forEach(concurrency, n int, fn func(i int) bool) bool {
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+
+	sem := make(chan struct{}, max(concurrency, 1))
+
+	for i := 0; i < n && !stop.Load(); i++ {
+		sem <- struct{}{}
+
+		// a call may have asked to stop while waiting for a free worker
+		if stop.Load() {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if fn(i) {
+				stop.Store(true)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	return stop.Load()
+}
+
+func listEntityType(ctx context.Context, cbClient client.ContextBrokerClient, typeName string) (*entityTypeState, error) {
+	state := &entityTypeState{
+		storedHashes: map[string]string{},
+		attributes:   map[string]map[string]bool{},
+		currentIDs:   map[string]bool{},
+	}
+
+	existing, err := cip.ListEntities(ctx, cbClient, typeName)
+	if err != nil {
+		return state, err
+	}
+
+	state.listed = true
+	state.existing = existing
+
+	for _, e := range existing {
+		state.storedHashes[e.ID()] = cip.StoredContentHash(e)
+
+		names := map[string]bool{}
+		e.ForEachAttribute(func(attributeType, attributeName string, contents any) {
+			names[attributeName] = true
+		})
+		state.attributes[e.ID()] = names
+	}
+
+	return state, nil
+}
+
+// syncSite merges or creates the entity of a site, unless it is unchanged since the last run. With
+// useBatch the entity is returned as pending instead, to be upserted together with other entities.
+func syncSite(ctx context.Context, cfg Config, ms []mapping.ServiceType, state *entityTypeState, site serviceguiden.Site, entry *report.Entity, useBatch bool) (*pendingEntity, error) {
+	logger := logging.GetFromContext(ctx)
+
+	m := ms[0]
+	props := entityProps(ctx, cfg, ms, site, entry)
+
+	hash, err := cip.ContentHash(props)
+	if err != nil {
+		logger.Error("failed to hash entity", slog.String("entity_id", entry.ID), slog.String("err", err.Error()))
+		entry.Fail(err)
+		return nil, err
+	}
+
+	stale, err := staleAttributes(props, optionalAttributes(cfg, ms), state.attributes[entry.ID])
+	if err != nil {
+		entry.Fail(err)
+		return nil, err
+	}
+
+	storedHash, exists := state.storedHashes[entry.ID]
+	if exists && storedHash == hash && len(stale) == 0 {
+		entry.Outcome = report.Unchanged
+		return nil, nil
+	}
+
+	props = append(props, cip.WithContentHash(hash))
+
+	for _, name := range stale {
+		logger.Debug("deleting attribute that is no longer published", slog.String("entity_id", entry.ID), slog.String("attribute", name))
+		props = append(props, cip.DeleteAttribute(name))
+	}
+
+	// batch upserts only add and replace attributes, so entities with attributes to delete are merged on their own.
+	// Entities are only batched when it is known whether they exist, so that dateCreated is set on new entities.
+	if useBatch && state.listed && len(stale) == 0 {
+		outcome := report.Merged
+		if !exists {
+			outcome = report.Created
+		}
+		return &pendingEntity{id: entry.ID, typeName: m.EntityType, props: props, entry: entry, outcome: outcome}, nil
+	}
+
+	if cfg.DryRun {
+		err = diffEntity(ctx, cfg.CBClient, entry.ID, props, entry)
+	} else {
+		var created bool
+		created, err = cip.MergeOrCreate(ctx, cfg.CBClient, entry.ID, m.EntityType, props)
+		if err == nil {
+			entry.Outcome = mergeOutcome(created)
+		}
+	}
+
+	if err != nil {
+		logger.Error("failed to merge entity", slog.String("entity_id", entry.ID), slog.String("err", err.Error()))
+		entry.Fail(err)
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// optionalAttributes returns the attributes that are published for some sites, or in some runs, but not for
+// others. They are deleted from existing entities when they are no longer published.
+func optionalAttributes(cfg Config, ms []mapping.ServiceType) []string {
+	names := []string{}
+
+	if ms[0].EntityType == fiware.BeachTypeName {
+		names = append(names, "refDevice")
+	}
+
+	for _, m := range ms {
+		if m.Mapper != nil {
+			names = append(names, m.Mapper.Properties()...)
+		}
+	}
+
+	// descriptions in formats that are no longer published are deleted, unless descriptions are not published at all
+	if len(cfg.Descriptions.Formats) > 0 {
+		names = append(names, cip.DescriptionAttributes()...)
+	}
+
+	if cfg.Advisories != nil {
+		for _, property := range cfg.Advisories.Properties() {
+			validFrom, validThrough := advisory.DateProperties(property)
+			names = append(names, validFrom, validThrough)
+		}
+	}
+
+	return names
+}
+
+// staleAttributes returns the optional attributes that an existing entity has, but that props no longer produce
+func staleAttributes(props []entities.EntityDecoratorFunc, optional []string, existing map[string]bool) ([]string, error) {
+	if len(existing) == 0 {
+		return nil, nil
+	}
+
+	fragment, err := entities.NewFragment(props...)
+	if err != nil {
+		return nil, err
+	}
+
+	produced := map[string]bool{}
+	fragment.ForEachAttribute(func(attributeType, attributeName string, contents any) {
+		produced[attributeName] = true
+	})
+
+	stale := []string{}
+	for _, name := range optional {
+		if existing[name] && !produced[name] {
+			stale = append(stale, name)
+		}
+	}
+
+	return stale, nil
+}
+
+// entityProps creates all properties that are published for a site, i.e. the properties of its kind
+// of site, its description, its mapped attribute values and the notices found in its description.
+// The entity gets the categories of each of the mappings ms, and the attributes of each service type
+// are mapped with the attribute mappings of that service type.
+func entityProps(ctx context.Context, cfg Config, ms []mapping.ServiceType, site serviceguiden.Site, entry *report.Entity) []entities.EntityDecoratorFunc {
+	logger := logging.GetFromContext(ctx)
+
+	m := ms[0]
+	for _, other := range ms[1:] {
+		m.Category = mergeCategories(m.Category, other.Category)
+	}
+
+	props := siteProps(ctx, cfg, m, site, entry)
+	props = append(props, cfg.Descriptions.Props(site.Description())...)
+
+	for _, st := range ms {
+		if st.Mapper == nil {
+			continue
+		}
+
+		mapped, unmapped := st.Mapper.Map(site.ServiceTypeAttributes(st.ServiceType))
+		props = append(props, mapped...)
+
+		for _, u := range unmapped {
+			logger.Warn("unmapped attribute value", slog.String("entity_id", entry.ID), slog.String("attribute", u))
+			entry.Warn(fmt.Sprintf("unmapped attribute value %q", u))
+		}
+	}
+
+	if cfg.Advisories != nil {
+		// descriptions rarely mention a year, so dates are placed in the year the site was last modified
+		reference := site.LastModified()
+		if reference.IsZero() {
+			reference = time.Now()
+		}
+		props = append(props, advisory.Decorators(cfg.Advisories.Properties(), cfg.Advisories.Extract(site.Description(), reference))...)
+	}
+
+	return props
+}
+
+// Preview returns the beach entities that a run would publish, without reading from or writing to
+// the context broker other than to verify referenced devices. If sourceID is not empty, only the beach
+// with that ServiceGuiden id is returned.
+func Preview(ctx context.Context, sgClient serviceguiden.ServiceGuidenClient, cfg Config, sourceID string) ([]types.Entity, error) {
+	result := []types.Entity{}
+
+	for _, m := range cfg.Mappings {
+		if m.EntityType != fiware.BeachTypeName {
+			continue
+		}
+
+		sites, err := sgClient.Sites(ctx, m.ServiceType)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, site := range sites {
+			if sourceID != "" && site.ID() != sourceID {
+				continue
+			}
+
+			entry := &report.Entity{ID: EntityID(m, site.ID()), SourceID: site.ID()}
+
+			e, err := entities.New(entry.ID, m.EntityType, entityProps(ctx, cfg, []mapping.ServiceType{m}, site, entry)...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create entity %s, %w", entry.ID, err)
+			}
+
+			result = append(result, e)
+		}
+	}
+
+	if sourceID != "" && len(result) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrSiteNotFound, sourceID)
+	}
+
+	return result, nil
+}
+
+// FindSite returns ErrSiteNotFound if none of the mapped service types has a site with the given ServiceGuiden id
+func FindSite(ctx context.Context, sgClient serviceguiden.ServiceGuidenClient, cfg Config, sourceID string) error {
+	for _, m := range cfg.Mappings {
+		sites, err := sgClient.Sites(ctx, m.ServiceType)
+		if err != nil {
+			return err
+		}
+
+		for _, site := range sites {
+			if site.ID() == sourceID {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrSiteNotFound, sourceID)
+}
+
+// mergeCategories returns the categories of a followed by those of b that are not in a
+func mergeCategories(a, b []string) []string {
+	merged := slices.Clone(a)
+	for _, c := range b {
+		if !slices.Contains(merged, c) {
+			merged = append(merged, c)
+		}
+	}
+	return merged
+}
+
+// EntityID returns the id of the entity that a ServiceGuiden site is published as
+func EntityID(m mapping.ServiceType, serviceGuidenID string) string {
+	return m.IDPrefix + deterministicGUID("ServiceGuiden", serviceGuidenID)
+}
+
+// siteProps creates the properties of a site. Beaches get their NUTS code, device and geometry from
+// the lookup table and geometry source, all other sites are published with their generic properties.
+func siteProps(ctx context.Context, cfg Config, m mapping.ServiceType, site serviceguiden.Site, entry *report.Entity) []entities.EntityDecoratorFunc {
+	badplats, ok := site.(serviceguiden.Beach)
+	if !ok || m.EntityType != fiware.BeachTypeName {
+		return cip.NewSiteProps(site, m.Category)
+	}
+
+	nutsCode, ok := cfg.LookupTable.GetNutsCode(badplats.ID())
+	metrics.Lookup(ctx, metrics.NutsCode, ok)
+
+	deviceID := lookupDevice(ctx, cfg.CBClient, cfg.LookupTable, badplats.ID(), entry)
+	shape := cfg.Geometries.MultiPolygon(badplats.ID(), badplats.Position().Latitude, badplats.Position().Longitude)
+
+	return cip.NewBeachProps(badplats, nutsCode, deviceID, shape)
+}
+
+type pendingEntity struct {
+	id       string
+	typeName string
+	props    []entities.EntityDecoratorFunc
+	entry    *report.Entity
+	outcome  string
+}
+
+// upsertChunk upserts a chunk of entities in a single batch request, falling back to merging or
+// creating each entity on its own if the batch request fails as a whole
+func upsertChunk(ctx context.Context, cfg Config, chunk []pendingEntity) error {
+	logger := logging.GetFromContext(ctx)
+
+	start := time.Now()
+	defer func() {
+		for _, p := range chunk {
+			p.entry.Took(start)
+		}
+	}()
+
+	batch := make([]types.Entity, 0, len(chunk))
+	for _, p := range chunk {
+		props := p.props
+		if p.outcome == report.Created {
+			props = append(props, cip.DateCreated())
+		}
+
+		e, err := entities.New(p.id, p.typeName, props...)
+		if err != nil {
+			return fmt.Errorf("failed to create entity %s, %w", p.id, err)
+		}
+		batch = append(batch, e)
+	}
+
+	requestStart := time.Now()
+	result, err := cfg.BatchClient.Upsert(ctx, batch)
+	metrics.ContextBrokerRequest(ctx, "upsert", requestStart, err)
+	health.ContextBroker.Attempt(err)
+
+	if err != nil {
+		logger.Warn("batch upsert failed, falling back to merging each entity", slog.Int("count", len(chunk)), slog.String("err", err.Error()))
+
+		errs := []error{}
+		for _, p := range chunk {
+			created, err := cip.MergeOrCreate(ctx, cfg.CBClient, p.id, p.typeName, p.props)
+			if err != nil {
+				logger.Error("failed to merge entity", slog.String("entity_id", p.id), slog.String("err", err.Error()))
+				p.entry.Fail(err)
+				errs = append(errs, err)
+				if errors.Is(err, retry.ErrCircuitOpen) {
+					break
+				}
+				continue
+			}
+			p.entry.Outcome = mergeOutcome(created)
+		}
+		return errors.Join(errs...)
+	}
+
+	errs := []error{}
+	for _, p := range chunk {
+		if err, ok := result.Failed[p.id]; ok {
+			err = fmt.Errorf("failed to upsert entity %s, %w", p.id, err)
+			logger.Error("failed to upsert entity", slog.String("entity_id", p.id), slog.String("err", err.Error()))
+			p.entry.Fail(err)
+			errs = append(errs, err)
+			continue
+		}
+		p.entry.Outcome = p.outcome
+	}
+
+	return errors.Join(errs...)
+}
+
+func mergeOutcome(created bool) string {
+	if created {
+		return report.Created
+	}
+	return report.Merged
+}
+
+func diffEntity(ctx context.Context, cbClient client.ContextBrokerClient, entityID string, props []entities.EntityDecoratorFunc, entry *report.Entity) error {
+	created, changes, err := cip.Diff(ctx, cbClient, entityID, props)
+	if err != nil {
+		return err
+	}
+
+	entry.Changes = changes
+
+	switch {
+	case created:
+		entry.Outcome = report.Created
+	case len(changes) > 0:
+		entry.Outcome = report.Merged
+	default:
+		entry.Outcome = report.Unchanged
+	}
+
+	return nil
+}
+
+// lookupDevice returns the device id referenced in the lookup table, but only if the device exists in the context broker
+func lookupDevice(ctx context.Context, cbClient client.ContextBrokerClient, lookupTable lookup.LookupTable, serviceGuidenID string, entry *report.Entity) string {
+	logger := logging.GetFromContext(ctx)
+
+	deviceID, ok := lookupTable.GetDeviceId(serviceGuidenID)
+	metrics.Lookup(ctx, metrics.DeviceID, ok)
+
+	if !ok {
+		return ""
+	}
+
+	refDevice := cip.DeviceID(deviceID)
+
+	exists, err := cip.EntityExists(ctx, cbClient, refDevice)
+	if err != nil {
+		logger.Warn("could not verify that device exists, skipping refDevice", slog.String("device_id", refDevice), slog.String("err", err.Error()))
+		entry.Warn(fmt.Sprintf("could not verify that device %s exists: %s", refDevice, err.Error()))
+		return ""
+	}
+
+	if !exists {
+		logger.Warn("device not found in context broker, skipping refDevice", slog.String("device_id", refDevice), slog.String("beach_id", entry.ID))
+		entry.Warn(fmt.Sprintf("device %s not found in context broker", refDevice))
+		return ""
+	}
+
+	return deviceID
+}
+
+// idNamespace is the UUID namespace of the entities that are published by this integration
+var idNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("https://github.com/diwise/integration-cip-gbg-ms"))
+
+// deterministicGUID returns a name based (version 5) UUID for an id from a data provider
+func deterministicGUID(dataProvider string, id string) string {
+	return uuid.NewSHA1(idNamespace, []byte(dataProvider+":"+id)).String()
+}
+
+// LegacyEntityID returns the id that a ServiceGuiden site was published as before name based UUIDs were
+// used, so that entities can be migrated to their current ids
+func LegacyEntityID(m mapping.ServiceType, serviceGuidenID string) string {
+	return m.IDPrefix + legacyGUID("ServiceGuiden", serviceGuidenID)
+}
+
+// legacyGUID builds a UUID from the ASCII bytes of the first 16 hex characters of an MD5 hash
+func legacyGUID(dataProvider string, id string) string {
+	md5hash := md5.Sum([]byte(id + dataProvider))
+	md5string := hex.EncodeToString(md5hash[:])
+
+	// 16 bytes are always a valid UUID
+	return uuid.Must(uuid.FromBytes([]byte(md5string[0:16]))).String()
+}
@@ -0,0 +1,573 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+	test "github.com/diwise/context-broker/pkg/test"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/advisory"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/attributes"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/cip"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/description"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/diff"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/geometry"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/mapping"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/report"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/retry"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/serviceguiden"
+	"github.com/matryer/is"
+)
+
+var (
+	askim     = serviceguiden.Content{ID_: "61e0a244cfc4d247cca95f4e", Name_: "Askimsbadet", BusinessID_: 3683}
+	bergsjon  = serviceguiden.Content{ID_: "61e0a252cfc4d247cca9698b", Name_: "Bergsjön", BusinessID_: 3690}
+	aspholmen = serviceguiden.Content{ID_: "61e0a246cfc4d247cca9604c", Name_: "Aspholmen", BusinessID_: 3684}
+	utegym    = serviceguiden.Content{ID_: "61e0a2a1cfc4d247cca9b0a5", Name_: "Utegym Ruddalen", BusinessID_: 4012}
+
+	sportsField = mapping.ServiceType{ServiceType: "Utegym", EntityType: "SportsField", IDPrefix: "urn:ngsi-ld:SportsField:", Category: []string{"outdoorGym"}}
+)
+
+func TestDryRunDoesNotWrite(t *testing.T) {
+	is := is.New(t)
+
+	existing, _ := entities.New(beachID(askim), "Beach")
+	cbClient := brokerMock(existing)
+	cbClient.RetrieveEntityFunc = func(ctx context.Context, entityID string, headers map[string][]string) (types.Entity, error) {
+		if entityID == beachID(askim) {
+			return entities.New(entityID, "Beach", decorators.Name("Askimsbadet (old)"))
+		}
+		return nil, ngsierrors.NewNotFoundError("not found")
+	}
+
+	cfg := testConfig(t, cbClient, withReconcile, func(cfg *Config) { cfg.DryRun = true })
+
+	rpt, err := Run(context.Background(), beachesMock(askim, bergsjon), cfg)
+	is.NoErr(err)
+
+	is.True(rpt.DryRun)
+	is.Equal(0, len(cbClient.MergeEntityCalls()))
+	is.Equal(0, len(cbClient.CreateEntityCalls()))
+	is.Equal(0, len(cbClient.DeleteEntityCalls()))
+
+	is.Equal(1, rpt.Count(report.Merged))
+	is.Equal(1, rpt.Count(report.Created))
+	is.True(hasChange(rpt.Entity(beachID(askim), askim.ID()).Changes, "name", diff.Changed))
+}
+
+func TestBatchFallsBackToMergeOrCreate(t *testing.T) {
+	is := is.New(t)
+
+	cbClient := brokerMock()
+	batchClient := &batchClientMock{failAt: 2}
+	cfg := testConfig(t, cbClient, withBatch(batchClient, 2))
+
+	rpt, err := Run(context.Background(), beachesMock(askim, bergsjon, aspholmen), cfg)
+	is.NoErr(err)
+
+	is.Equal(2, batchClient.calls)
+	is.Equal(1, len(cbClient.MergeEntityCalls())) // the second chunk only contains one beach
+	is.Equal(3, rpt.Count(report.Created))
+}
+
+func TestUnchangedBeachesAreSkipped(t *testing.T) {
+	is := is.New(t)
+
+	cfg := testConfig(t, nil)
+
+	hash, err := cip.ContentHash(cip.NewBeachProps(askim, "", "", cfg.Geometries.MultiPolygon(askim.ID(), 0, 0)))
+	is.NoErr(err)
+
+	askimEntity, _ := entities.New(beachID(askim), "Beach", cip.WithContentHash(hash))
+	bergsjonEntity, _ := entities.New(beachID(bergsjon), "Beach", cip.WithContentHash("outdated"))
+
+	cbClient := brokerMock(askimEntity, bergsjonEntity)
+	cfg.CBClient = cbClient
+
+	rpt, err := Run(context.Background(), beachesMock(askim, bergsjon), cfg)
+	is.NoErr(err)
+
+	is.Equal(1, len(cbClient.MergeEntityCalls()))
+	is.Equal(beachID(bergsjon), cbClient.MergeEntityCalls()[0].EntityID)
+	is.Equal(1, rpt.Count(report.Unchanged))
+	is.Equal(1, rpt.Count(report.Merged))
+}
+
+func TestRemovedDeviceIsDeleted(t *testing.T) {
+	is := is.New(t)
+
+	batchClient := &batchClientMock{}
+	cfg := testConfig(t, nil, withBatch(batchClient, 10))
+
+	// the beach is unchanged except that its device is no longer in the lookup table
+	hash, err := cip.ContentHash(cip.NewBeachProps(askim, "", "", cfg.Geometries.MultiPolygon(askim.ID(), 0, 0)))
+	is.NoErr(err)
+
+	askimEntity, _ := entities.New(beachID(askim), "Beach", cip.WithContentHash(hash), decorators.RefDevice("urn:ngsi-ld:Device:temp-01"))
+	cbClient := brokerMock(askimEntity)
+	cfg.CBClient = cbClient
+
+	rpt, err := Run(context.Background(), beachesMock(askim), cfg)
+	is.NoErr(err)
+
+	is.Equal(0, batchClient.calls) // a batch upsert can not delete attributes
+	is.Equal(1, len(cbClient.MergeEntityCalls()))
+	is.Equal(1, rpt.Count(report.Merged))
+	is.True(strings.Contains(mergedJSON(t, cbClient, 0), `"refDevice":"urn:ngsi-ld:null"`))
+}
+
+func TestUnpublishedDescriptionFormatsAreDeleted(t *testing.T) {
+	is := is.New(t)
+
+	site := askim
+	site.Description_ = "<p>Sandstrand</p>"
+
+	// the beach was published when descriptions were also published as markdown
+	askimEntity, _ := entities.New(beachID(askim), "Beach", decorators.Description("<p>Sandstrand</p>"), decorators.Text("descriptionMarkdown", "Sandstrand"))
+	cbClient := brokerMock(askimEntity)
+
+	cfg := testConfig(t, cbClient, func(cfg *Config) {
+		cfg.Descriptions = cip.Descriptions{Formats: []description.Format{description.HTML, description.Text}}
+	})
+
+	_, err := Run(context.Background(), beachesMock(site), cfg)
+	is.NoErr(err)
+
+	is.Equal(1, len(cbClient.MergeEntityCalls()))
+
+	merged := mergedJSON(t, cbClient, 0)
+	is.True(strings.Contains(merged, `"descriptionText":{"type":"Property","value":"Sandstrand"}`))
+	is.True(strings.Contains(merged, `"descriptionMarkdown":"urn:ngsi-ld:null"`))
+}
+
+func TestLiftedNoticeIsUnpublished(t *testing.T) {
+	is := is.New(t)
+
+	advisories, err := advisory.New([]advisory.Rule{{Property: "bathingAdvisory", Patterns: []string{"avrådan från bad"}}})
+	is.NoErr(err)
+
+	withAdvisories := func(cfg *Config) { cfg.Advisories = advisories }
+
+	site := askim
+	site.Description_ = "<p>Göteborgs Stad har beslutat om avrådan från bad vid Askimsbadet från och med 13 augusti.</p>"
+
+	first := brokerMock()
+	_, err = Run(context.Background(), beachesMock(site), testConfig(t, first, withAdvisories))
+	is.NoErr(err)
+
+	is.Equal(1, len(first.CreateEntityCalls()))
+	created := first.CreateEntityCalls()[0].Entity
+
+	b, err := created.MarshalJSON()
+	is.NoErr(err)
+	is.True(strings.Contains(string(b), `"bathingAdvisory":{"type":"Property","value":true}`))
+	is.True(strings.Contains(string(b), `"bathingAdvisoryValidFrom"`))
+
+	// the advisory is lifted before the next run
+	site.Description_ = "<p>Vattnet är tjänligt att bada i.</p>"
+
+	second := brokerMock(created)
+	_, err = Run(context.Background(), beachesMock(site), testConfig(t, second, withAdvisories))
+	is.NoErr(err)
+
+	is.Equal(1, len(second.MergeEntityCalls()))
+
+	merged := mergedJSON(t, second, 0)
+	is.True(strings.Contains(merged, `"bathingAdvisory":{"type":"Property","value":false}`))
+	is.True(strings.Contains(merged, `"bathingAdvisoryValidFrom":"urn:ngsi-ld:null"`))
+}
+
+func TestRunRefusesLegacyIDs(t *testing.T) {
+	is := is.New(t)
+
+	legacy, _ := entities.New(LegacyEntityID(mapping.Default(nil)[0], askim.ID()), "Beach", decorators.Name("Askimsbadet"))
+	cbClient := brokerMock(legacy)
+
+	_, err := Run(context.Background(), beachesMock(askim), testConfig(t, cbClient, withReconcile))
+	is.True(errors.Is(err, ErrLegacyIDs))
+
+	is.Equal(0, len(cbClient.CreateEntityCalls()))
+	is.Equal(0, len(cbClient.MergeEntityCalls()))
+	is.Equal(0, len(cbClient.DeleteEntityCalls()))
+}
+
+func TestCreatedWhenExistingEntitiesCanNotBeListed(t *testing.T) {
+	is := is.New(t)
+
+	bergsjonEntity, _ := entities.New(beachID(bergsjon), "Beach")
+	cbClient := brokerMock(bergsjonEntity)
+	cbClient.QueryEntitiesFunc = func(ctx context.Context, entityTypes, entityAttributes []string, query string, headers map[string][]string) (*ngsild.QueryEntitiesResult, error) {
+		return nil, errors.New("query failed")
+	}
+
+	batchClient := &batchClientMock{}
+
+	rpt, err := Run(context.Background(), beachesMock(askim, bergsjon), testConfig(t, cbClient, withBatch(batchClient, 10)))
+	is.True(err != nil)
+
+	is.Equal(0, batchClient.calls)
+	is.Equal(1, rpt.Count(report.Created))
+	is.Equal(1, rpt.Count(report.Merged))
+	is.True(strings.Contains(createdJSON(t, cbClient, 0), "dateCreated"))
+}
+
+func TestOtherSiteTypesAreMapped(t *testing.T) {
+	is := is.New(t)
+
+	cbClient := brokerMock()
+	cfg := testConfig(t, cbClient, withReconcile, func(cfg *Config) { cfg.Mappings = append(cfg.Mappings, sportsField) })
+
+	sgClient := beachesMock(askim)
+	sgClient.sites = map[string][]serviceguiden.Site{"Utegym": {utegym}}
+
+	rpt, err := Run(context.Background(), sgClient, cfg)
+	is.NoErr(err)
+
+	is.Equal(2, len(cbClient.CreateEntityCalls()))
+	is.Equal(2, rpt.Count(report.Created))
+
+	created := cbClient.CreateEntityCalls()[1].Entity
+	is.Equal(EntityID(sportsField, utegym.ID()), created.ID())
+	is.Equal("SportsField", created.Type())
+	is.True(strings.Contains(createdJSON(t, cbClient, 1), `"outdoorGym"`))
+}
+
+func TestSitesWithSeveralServiceTypesAreMerged(t *testing.T) {
+	is := is.New(t)
+
+	field := serviceguiden.Content{ID_: "61e0a2a1cfc4d247cca9b0a5", Name_: "Ruddalens IP", BusinessID_: 4012, ServiceTypes: []serviceguiden.ServiceType{
+		{Name: "Utegym", Attributes: []serviceguiden.Attribute{{Name: "Redskap", Values: []serviceguiden.Value{{Name: "Chins"}}}}},
+		{Name: "Bollplaner", Attributes: []serviceguiden.Attribute{{Name: "Underlag", Values: []serviceguiden.Value{{Name: "Konstgräs"}}}}},
+	}}
+
+	outdoorGym := sportsField
+	outdoorGym.Mapper = attributes.New([]attributes.Mapping{{Attribute: "Redskap", Value: "Chins", Property: "equipment", MappedValue: "chinUpBar"}})
+
+	ballField := sportsField
+	ballField.ServiceType = "Bollplaner"
+	ballField.Category = []string{"ballField"}
+	ballField.Mapper = attributes.New([]attributes.Mapping{{Attribute: "Underlag", Value: "Konstgräs", Property: "surface", MappedValue: "artificialTurf"}})
+
+	cbClient := brokerMock()
+	cfg := testConfig(t, cbClient, withReconcile, func(cfg *Config) { cfg.Mappings = []mapping.ServiceType{outdoorGym, ballField} })
+
+	sgClient := &sgClientMock{sites: map[string][]serviceguiden.Site{"Utegym": {field}, "Bollplaner": {field}}}
+
+	rpt, err := Run(context.Background(), sgClient, cfg)
+	is.NoErr(err)
+
+	is.Equal(1, len(cbClient.CreateEntityCalls()))
+	is.Equal(0, len(rpt.Entities[0].Warnings)) // the attributes of one service type are not mapped with the mappings of the other
+
+	created := createdJSON(t, cbClient, 0)
+	is.True(strings.Contains(created, `["outdoorGym","ballField"]`))
+	is.True(strings.Contains(created, `"chinUpBar"`))
+	is.True(strings.Contains(created, `"artificialTurf"`))
+}
+
+func TestExerciseTrailsAreMapped(t *testing.T) {
+	is := is.New(t)
+
+	mappings, err := mapping.Load("../../../../assets/config/mappings.yaml")
+	is.NoErr(err)
+
+	trail := serviceguiden.Content{ID_: "61e0a2a1cfc4d247cca9b0b7", Name_: "Motionsspår Delsjön", BusinessID_: 4107}
+
+	cbClient := brokerMock()
+	cfg := testConfig(t, cbClient, withReconcile, func(cfg *Config) { cfg.Mappings = mappings })
+
+	rpt, err := Run(context.Background(), &sgClientMock{sites: map[string][]serviceguiden.Site{"Motionsspår": {trail}}}, cfg)
+	is.NoErr(err)
+
+	is.Equal(1, len(cbClient.CreateEntityCalls()))
+	is.Equal(1, rpt.Count(report.Created))
+
+	exerciseTrail := cbClient.CreateEntityCalls()[0].Entity
+	is.Equal("urn:ngsi-ld:ExerciseTrail:"+deterministicGUID("ServiceGuiden", trail.ID()), exerciseTrail.ID())
+	is.Equal("ExerciseTrail", exerciseTrail.Type())
+}
+
+func TestRunForSingleSite(t *testing.T) {
+	is := is.New(t)
+
+	bergsjonEntity, _ := entities.New(beachID(bergsjon), "Beach")
+	cbClient := brokerMock(bergsjonEntity)
+	cfg := testConfig(t, cbClient, withReconcile, func(cfg *Config) { cfg.SourceID = askim.ID() })
+
+	rpt, err := Run(context.Background(), beachesMock(askim, bergsjon), cfg)
+	is.NoErr(err)
+
+	is.Equal(1, len(rpt.Entities))
+	is.Equal(askim.ID(), rpt.Entities[0].SourceID)
+	is.Equal(1, len(cbClient.MergeEntityCalls()))
+	is.Equal(0, len(cbClient.DeleteEntityCalls())) // the other beach must not be reconciled
+
+	cfg.SourceID = "unknown"
+	_, err = Run(context.Background(), beachesMock(askim, bergsjon), cfg)
+	is.True(errors.Is(err, ErrSiteNotFound))
+}
+
+func TestFindSite(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	cfg := testConfig(t, nil, func(cfg *Config) { cfg.Mappings = append(cfg.Mappings, sportsField) })
+	sgClient := &sgClientMock{sites: map[string][]serviceguiden.Site{"Utegym": {utegym}}}
+
+	is.NoErr(FindSite(ctx, sgClient, cfg, utegym.ID()))
+	is.True(errors.Is(FindSite(ctx, sgClient, cfg, "unknown"), ErrSiteNotFound))
+}
+
+func TestPreview(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	cbClient := brokerMock()
+	cfg := testConfig(t, cbClient, func(cfg *Config) { cfg.Mappings = append(cfg.Mappings, sportsField) })
+
+	sgClient := beachesMock(askim, bergsjon)
+	sgClient.sites = map[string][]serviceguiden.Site{"Utegym": {utegym}}
+
+	beaches, err := Preview(ctx, sgClient, cfg, "")
+	is.NoErr(err)
+	is.Equal(2, len(beaches))
+	is.Equal("Beach", beaches[0].Type())
+
+	beaches, err = Preview(ctx, sgClient, cfg, bergsjon.ID())
+	is.NoErr(err)
+	is.Equal(1, len(beaches))
+	is.Equal(beachID(bergsjon), beaches[0].ID())
+
+	_, err = Preview(ctx, sgClient, cfg, utegym.ID())
+	is.True(errors.Is(err, ErrSiteNotFound))
+
+	is.Equal(0, len(cbClient.MergeEntityCalls()))
+	is.Equal(0, len(cbClient.CreateEntityCalls()))
+}
+
+func TestOpenCircuitStopsRun(t *testing.T) {
+	is := is.New(t)
+
+	cbClient := brokerMock()
+	cbClient.MergeEntityFunc = func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+		return nil, retry.ErrCircuitOpen
+	}
+
+	rpt, err := Run(context.Background(), beachesMock(askim, bergsjon), testConfig(t, cbClient, withReconcile))
+	is.True(errors.Is(err, retry.ErrCircuitOpen))
+
+	is.Equal(1, len(cbClient.MergeEntityCalls()))
+	is.Equal(1, rpt.Count(report.Failed))
+}
+
+func TestConcurrentRunKeepsSiteOrder(t *testing.T) {
+	is := is.New(t)
+
+	beaches := []serviceguiden.Content{}
+	for i := range 20 {
+		beaches = append(beaches, serviceguiden.Content{ID_: fmt.Sprintf("61e0a244cfc4d247cca95f%02d", i), Name_: fmt.Sprintf("Badplats %d", i), BusinessID_: 3683})
+	}
+
+	var running, maxRunning atomic.Int32
+
+	cbClient := brokerMock()
+	cbClient.MergeEntityFunc = func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond)
+
+		if entityID == beachID(beaches[3]) {
+			return nil, errors.New("merge failed")
+		}
+		return nil, ngsierrors.NewNotFoundError("not found")
+	}
+
+	rpt, err := Run(context.Background(), beachesMock(beaches...), testConfig(t, cbClient, func(cfg *Config) { cfg.Concurrency = 4 }))
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "merge failed"))
+
+	is.Equal(20, len(cbClient.MergeEntityCalls()))
+	is.True(maxRunning.Load() > 1)
+	is.True(maxRunning.Load() <= 4)
+
+	for i, e := range rpt.Entities {
+		is.Equal(beaches[i].ID(), e.SourceID)
+	}
+	is.Equal(report.Failed, rpt.Entities[3].Outcome)
+	is.Equal(19, rpt.Count(report.Created))
+}
+
+func TestEntityIDs(t *testing.T) {
+	is := is.New(t)
+
+	beach := mapping.Default(nil)[0]
+
+	is.Equal("urn:ngsi-ld:Beach:a577136a-61e1-576b-91d2-3ac43ce96583", EntityID(beach, "61e0a244cfc4d247cca95f4e"))
+	is.Equal("urn:ngsi-ld:Beach:35396562-3461-6364-3930-353963366531", LegacyEntityID(beach, "61e0a244cfc4d247cca95f4e"))
+	is.True(EntityID(beach, "61e0a244cfc4d247cca95f4e") != EntityID(beach, "61e0a252cfc4d247cca9698b"))
+}
+
+// testConfig returns a config that syncs beaches to cbClient without reconciling, changed by each of the overrides
+func testConfig(t *testing.T, cbClient client.ContextBrokerClient, overrides ...func(*Config)) Config {
+	geometries, err := geometry.New(context.Background(), "", 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{
+		LookupTable: &lookupMock{},
+		Geometries:  geometries,
+		Mappings:    mapping.Default(nil),
+		CBClient:    cbClient,
+		Reconcile:   cip.ReconcileOptions{Mode: cip.ReconcileOff},
+	}
+
+	for _, override := range overrides {
+		override(&cfg)
+	}
+
+	return cfg
+}
+
+func withReconcile(cfg *Config) {
+	cfg.Reconcile = cip.ReconcileOptions{Mode: cip.ReconcileDelete, MaxFraction: 1}
+}
+
+func withBatch(batchClient cip.BatchClient, size int) func(*Config) {
+	return func(cfg *Config) {
+		cfg.BatchClient = batchClient
+		cfg.BatchSize = size
+	}
+}
+
+// brokerMock returns a context broker that lists the existing entities, merges into them and creates all other entities
+func brokerMock(existing ...types.Entity) *test.ContextBrokerClientMock {
+	ids := map[string]bool{}
+	for _, e := range existing {
+		ids[e.ID()] = true
+	}
+
+	return &test.ContextBrokerClientMock{
+		QueryEntitiesFunc: queryEntities(existing...),
+		MergeEntityFunc: func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+			if !ids[entityID] {
+				return nil, ngsierrors.NewNotFoundError("not found")
+			}
+			return &ngsild.MergeEntityResult{}, nil
+		},
+		CreateEntityFunc: func(ctx context.Context, entity types.Entity, headers map[string][]string) (*ngsild.CreateEntityResult, error) {
+			return &ngsild.CreateEntityResult{}, nil
+		},
+	}
+}
+
+func beachID(site serviceguiden.Site) string {
+	return EntityID(mapping.Default(nil)[0], site.ID())
+}
+
+func mergedJSON(t *testing.T, cbClient *test.ContextBrokerClientMock, call int) string {
+	b, err := cbClient.MergeEntityCalls()[call].Fragment.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func createdJSON(t *testing.T, cbClient *test.ContextBrokerClientMock, call int) string {
+	b, err := cbClient.CreateEntityCalls()[call].Entity.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func queryEntities(found ...types.Entity) func(ctx context.Context, entityTypes, entityAttributes []string, query string, headers map[string][]string) (*ngsild.QueryEntitiesResult, error) {
+	return func(ctx context.Context, entityTypes, entityAttributes []string, query string, headers map[string][]string) (*ngsild.QueryEntitiesResult, error) {
+		qer := ngsild.NewQueryEntitiesResult()
+		go func() {
+			for _, e := range found {
+				qer.Found <- e
+			}
+			qer.Found <- nil
+		}()
+		return qer, nil
+	}
+}
+
+type batchClientMock struct {
+	calls  int
+	failAt int
+}
+
+func (m *batchClientMock) Upsert(ctx context.Context, batch []types.Entity) (*cip.BatchResult, error) {
+	m.calls++
+	if m.calls == m.failAt {
+		return nil, errors.New("batch upsert not supported")
+	}
+
+	result := &cip.BatchResult{Failed: map[string]error{}}
+	for _, e := range batch {
+		result.Succeeded = append(result.Succeeded, e.ID())
+	}
+	return result, nil
+}
+
+func hasChange(changes []diff.Change, attribute string, kind diff.Kind) bool {
+	for _, c := range changes {
+		if c.Attribute == attribute && c.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func beachesMock(beaches ...serviceguiden.Content) *sgClientMock {
+	m := &sgClientMock{}
+	for _, b := range beaches {
+		m.beaches = append(m.beaches, b)
+	}
+	return m
+}
+
+type sgClientMock struct {
+	beaches []serviceguiden.Beach
+	sites   map[string][]serviceguiden.Site
+}
+
+func (m *sgClientMock) Badplatser(ctx context.Context) ([]serviceguiden.Beach, error) {
+	return m.beaches, nil
+}
+
+func (m *sgClientMock) Sites(ctx context.Context, serviceType string) ([]serviceguiden.Site, error) {
+	if serviceType == serviceguiden.BadplatserServiceType {
+		sites := []serviceguiden.Site{}
+		for _, b := range m.beaches {
+			sites = append(sites, b)
+		}
+		return sites, nil
+	}
+	return m.sites[serviceType], nil
+}
+
+type lookupMock struct{}
+
+func (lookupMock) GetNutsCode(serviceGuidenId string) (string, bool) { return "", false }
+func (lookupMock) GetDeviceId(serviceGuidenId string) (string, bool) { return "", false }
@@ -0,0 +1,70 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/metrics"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/report"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/serviceguiden"
+)
+
+// Runner runs the pipeline with a fixed configuration and keeps the report of the last run
+type Runner struct {
+	cfg       Config
+	newClient func(ctx context.Context) serviceguiden.ServiceGuidenClient
+
+	mu   sync.Mutex
+	last *report.Report
+}
+
+// NewRunner returns a runner that uses newClient to get a ServiceGuiden client for each run, so that
+// each run sees the current contents of ServiceGuiden
+func NewRunner(cfg Config, newClient func(ctx context.Context) serviceguiden.ServiceGuidenClient) *Runner {
+	return &Runner{
+		cfg:       cfg,
+		newClient: newClient,
+	}
+}
+
+// Run runs the pipeline for all sites, or only for the site with the given ServiceGuiden id if sourceID is not empty
+func (r *Runner) Run(ctx context.Context, sourceID string) (*report.Report, error) {
+	cfg := r.cfg
+	cfg.SourceID = sourceID
+
+	rpt, err := Run(ctx, r.newClient(ctx), cfg)
+
+	// dry runs do not change anything, so they are not counted
+	if !cfg.DryRun {
+		metrics.EntitiesSynced(ctx, rpt)
+		if err == nil && sourceID == "" {
+			metrics.RunSucceeded(rpt.FinishedAt)
+		}
+	}
+
+	r.mu.Lock()
+	r.last = rpt
+	r.mu.Unlock()
+
+	return rpt, err
+}
+
+// LastReport returns the report of the last run, or nil if nothing has been run yet
+func (r *Runner) LastReport() *report.Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.last
+}
+
+// FindSite returns ErrSiteNotFound if there is no mapped site with the given ServiceGuiden id
+func (r *Runner) FindSite(ctx context.Context, sourceID string) error {
+	return FindSite(ctx, r.newClient(ctx), r.cfg, sourceID)
+}
+
+// Preview returns the beach entities that a run would publish
+func (r *Runner) Preview(ctx context.Context, sourceID string) ([]types.Entity, error) {
+	return Preview(ctx, r.newClient(ctx), r.cfg, sourceID)
+}
@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// limiter spaces requests evenly, so that there are at most one request per interval
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := time.Until(at)
+	if delay <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// PerHost limits the rate of requests to each host
+type PerHost struct {
+	mu       sync.Mutex
+	interval time.Duration
+	limiters map[string]*limiter
+}
+
+// NewPerHost returns a limiter that allows requestsPerSecond requests to each host. Zero means no limit.
+func NewPerHost(requestsPerSecond float64) *PerHost {
+	p := &PerHost{limiters: map[string]*limiter{}}
+	if requestsPerSecond > 0 {
+		p.interval = time.Duration(float64(time.Second) / requestsPerSecond)
+	}
+	return p
+}
+
+// Wait blocks until a request to host is allowed, or ctx is cancelled
+func (p *PerHost) Wait(ctx context.Context, host string) error {
+	if p == nil || p.interval == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	l, ok := p.limiters[host]
+	if !ok {
+		l = &limiter{interval: p.interval}
+		p.limiters[host] = l
+	}
+	p.mu.Unlock()
+
+	return l.wait(ctx)
+}
+
+type transport struct {
+	next    http.RoundTripper
+	limiter *PerHost
+}
+
+// Transport limits the rate of requests sent with next
+func (p *PerHost) Transport(next http.RoundTripper) http.RoundTripper {
+	return &transport{next: next, limiter: p}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context(), req.URL.Host); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+// WaitFor returns a function that blocks until a request to the host of rawURL is allowed
+func (p *PerHost) WaitFor(rawURL string) func(context.Context) error {
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	return func(ctx context.Context) error {
+		return p.Wait(ctx, host)
+	}
+}
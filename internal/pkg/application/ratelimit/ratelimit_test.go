@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestRequestsToEachHostAreSpaced(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	p := NewPerHost(100) // one request per 10ms
+
+	start := time.Now()
+	for range 4 {
+		is.NoErr(p.Wait(ctx, "context-broker"))
+	}
+	is.True(time.Since(start) >= 30*time.Millisecond)
+
+	start = time.Now()
+	is.NoErr(p.Wait(ctx, "other-host")) // other hosts have their own limit
+	is.True(time.Since(start) < 10*time.Millisecond)
+}
+
+func TestWaitIsCancelled(t *testing.T) {
+	is := is.New(t)
+
+	p := NewPerHost(0.1)
+	is.NoErr(p.Wait(context.Background(), "context-broker"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	is.Equal(context.DeadlineExceeded, p.Wait(ctx, "context-broker"))
+}
+
+func TestNoLimit(t *testing.T) {
+	is := is.New(t)
+
+	p := NewPerHost(0)
+
+	start := time.Now()
+	for range 100 {
+		is.NoErr(p.Wait(context.Background(), "context-broker"))
+	}
+	is.True(time.Since(start) < 10*time.Millisecond)
+}
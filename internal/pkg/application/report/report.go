@@ -0,0 +1,194 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/diff"
+)
+
+// Report is the outcome of a run. Entries may be added concurrently, but each entry should only be
+// updated by one goroutine at a time.
+type Report struct {
+	mu sync.Mutex
+	// index is the entry of each entity id
+	index map[string]*Entity
+
+	DryRun     bool      `json:"dryRun"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	DurationMs int64     `json:"durationMs"`
+	Entities   []*Entity `json:"entities"`
+}
+
+const (
+	Created     string = "created"
+	Merged      string = "merged"
+	Unchanged   string = "unchanged"
+	Failed      string = "failed"
+	Deleted     string = "deleted"
+	Retired     string = "retired"
+	Reactivated string = "reactivated"
+)
+
+type Entity struct {
+	ID       string        `json:"id"`
+	Type     string        `json:"type,omitempty"`
+	SourceID string        `json:"sourceId,omitempty"`
+	Name     string        `json:"name,omitempty"`
+	Outcome  string        `json:"outcome,omitempty"`
+	Changes  []diff.Change `json:"changes,omitempty"`
+	Warnings []string      `json:"warnings,omitempty"`
+	Errors   []string      `json:"errors,omitempty"`
+	// DurationMs is the time spent on the entity, including its share of batch requests
+	DurationMs int64 `json:"durationMs,omitempty"`
+}
+
+func New(dryRun bool) *Report {
+	return &Report{
+		DryRun:    dryRun,
+		StartedAt: time.Now().UTC(),
+		Entities:  []*Entity{},
+		index:     map[string]*Entity{},
+	}
+}
+
+// Entity returns the report entry for an entity, adding a new entry the first time an entity id is seen
+func (r *Report) Entity(id, sourceID string) *Entity {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.index == nil {
+		// reports that are decoded from JSON have no index
+		r.index = map[string]*Entity{}
+		for _, e := range r.Entities {
+			r.index[e.ID] = e
+		}
+	}
+
+	if e, ok := r.index[id]; ok {
+		return e
+	}
+
+	e := &Entity{
+		ID:       id,
+		SourceID: sourceID,
+	}
+	r.Entities = append(r.Entities, e)
+	r.index[id] = e
+
+	return e
+}
+
+func (r *Report) Finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.FinishedAt = time.Now().UTC()
+	r.DurationMs = r.FinishedAt.Sub(r.StartedAt).Milliseconds()
+}
+
+func (r *Report) Warnings() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, e := range r.Entities {
+		count += len(e.Warnings)
+	}
+	return count
+}
+
+func (r *Report) Errors() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, e := range r.Entities {
+		count += len(e.Errors)
+	}
+	return count
+}
+
+// Took adds the time since start to the duration of the entity
+func (e *Entity) Took(start time.Time) {
+	e.DurationMs += time.Since(start).Milliseconds()
+}
+
+func (e *Entity) Warn(msg string) {
+	e.Warnings = append(e.Warnings, msg)
+}
+
+// Count returns the number of entities with a given outcome
+func (r *Report) Count(outcome string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, e := range r.Entities {
+		if e.Outcome == outcome {
+			count++
+		}
+	}
+	return count
+}
+
+func (e *Entity) Fail(err error) {
+	e.Outcome = Failed
+	e.Errors = append(e.Errors, err.Error())
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes a human readable summary of each entity and its changes
+func (r *Report) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var err error
+
+	printf := func(format string, a ...any) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, a...)
+		}
+	}
+
+	for _, e := range r.Entities {
+		printf("%s %s", e.Outcome, e.ID)
+		if e.Name != "" || e.SourceID != "" {
+			printf(" (%s %s)", e.Name, e.SourceID)
+		}
+		printf("\n")
+
+		for _, c := range e.Changes {
+			switch c.Kind {
+			case diff.Added:
+				printf("  + %s: %v\n", c.Attribute, c.New)
+			case diff.Changed:
+				printf("  ~ %s: %v -> %v\n", c.Attribute, c.Old, c.New)
+			case diff.Removed:
+				printf("  - %s: %v\n", c.Attribute, c.Old)
+			}
+		}
+
+		for _, warning := range e.Warnings {
+			printf("  warning: %s\n", warning)
+		}
+
+		for _, msg := range e.Errors {
+			printf("  error: %s\n", msg)
+		}
+	}
+
+	return err
+}
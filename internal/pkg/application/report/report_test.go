@@ -0,0 +1,30 @@
+package report
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestEntityReturnsTheSameEntry(t *testing.T) {
+	is := is.New(t)
+
+	r := New(false)
+
+	var wg sync.WaitGroup
+	for i := range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Entity(fmt.Sprintf("urn:ngsi-ld:Beach:%d", i%10), "")
+			r.Count(Created)
+		}()
+	}
+	wg.Wait()
+
+	is.Equal(10, len(r.Entities))
+	is.Equal(0, r.Count(Created))
+	is.Equal(r.Entities[0], r.Entity(r.Entities[0].ID, ""))
+}
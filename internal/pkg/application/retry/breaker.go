@@ -0,0 +1,64 @@
+package retry
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Breaker stops calls to a service that has failed too many times in a row. After a cooldown, a
+// single failure is enough to open the circuit again, while a success closes it.
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+}
+
+// NewBreaker returns a breaker that opens after threshold consecutive failures. A threshold of zero
+// disables the breaker.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Allow returns ErrCircuitOpen if calls should not be made
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold > 0 && b.failures >= b.threshold && time.Since(b.openedAt) < b.cooldown {
+		return ErrCircuitOpen
+	}
+
+	return nil
+}
+
+// Record records the outcome of a call, where a nil error is a success
+func (b *Breaker) Record(err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
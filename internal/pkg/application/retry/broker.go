@@ -0,0 +1,132 @@
+package retry
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/diwise/context-broker/pkg/ngsild"
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/health"
+)
+
+type contextBrokerClient struct {
+	client.ContextBrokerClient
+	policy  Policy
+	breaker *Breaker
+	// limit blocks until an attempt is allowed to be sent
+	limit func(context.Context) error
+}
+
+// ContextBroker retries requests made with c that fail because the context broker could not be reached or
+// failed to handle them. Each attempt is limited by the timeout of the policy. Requests fail with ErrCircuitOpen,
+// without being sent, while the breaker is open.
+//
+// Retry-After is not respected by these requests, since the context broker client neither exposes response headers
+// nor accepts another http client. Only batch upserts, which are sent through NewTransport, respect Retry-After.
+func ContextBroker(c client.ContextBrokerClient, policy Policy, breaker *Breaker, options ...func(*contextBrokerClient)) client.ContextBrokerClient {
+	cbc := &contextBrokerClient{
+		ContextBrokerClient: c,
+		policy:              policy,
+		breaker:             breaker,
+	}
+
+	for _, option := range options {
+		option(cbc)
+	}
+
+	return cbc
+}
+
+// RateLimit waits for limit before each attempt. The wait is neither part of the timeout of the attempt
+// nor a failure of the context broker.
+func RateLimit(limit func(context.Context) error) func(*contextBrokerClient) {
+	return func(c *contextBrokerClient) {
+		c.limit = limit
+	}
+}
+
+func do[T any](ctx context.Context, c *contextBrokerClient, operation string, call func(context.Context) (T, error)) (T, error) {
+	var zero T
+
+	if err := c.breaker.Allow(); err != nil {
+		return zero, err
+	}
+
+	b := c.policy.backOff(ctx)
+
+	for attempt := 1; ; attempt++ {
+		if c.limit != nil {
+			if err := c.limit(ctx); err != nil {
+				return zero, err
+			}
+		}
+
+		result, err := withTimeout(ctx, c.policy.Timeout, call)
+
+		unreachable := health.BrokerUnreachable(err)
+		if unreachable == nil || ctx.Err() != nil {
+			c.breaker.Record(unreachable)
+			return result, err
+		}
+
+		delay := b.NextBackOff()
+		if delay == backoff.Stop {
+			c.breaker.Record(unreachable)
+			return result, err
+		}
+
+		logging.GetFromContext(ctx).Warn("context broker request failed, retrying", slog.String("operation", operation), slog.Int("attempt", attempt), slog.Duration("delay", delay), slog.String("err", err.Error()))
+
+		if err := wait(ctx, delay); err != nil {
+			return zero, err
+		}
+	}
+}
+
+// withTimeout makes a single call with the timeout, if any. The client reads the whole response before it
+// returns, so the call can be cancelled as soon as it has returned.
+func withTimeout[T any](ctx context.Context, timeout time.Duration, call func(context.Context) (T, error)) (T, error) {
+	if timeout == 0 {
+		return call(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return call(ctx)
+}
+
+func (c *contextBrokerClient) CreateEntity(ctx context.Context, entity types.Entity, headers map[string][]string) (*ngsild.CreateEntityResult, error) {
+	return do(ctx, c, "create", func(ctx context.Context) (*ngsild.CreateEntityResult, error) {
+		return c.ContextBrokerClient.CreateEntity(ctx, entity, headers)
+	})
+}
+
+func (c *contextBrokerClient) QueryEntities(ctx context.Context, entityTypes, entityAttributes []string, query string, headers map[string][]string) (*ngsild.QueryEntitiesResult, error) {
+	return do(ctx, c, "query", func(ctx context.Context) (*ngsild.QueryEntitiesResult, error) {
+		return c.ContextBrokerClient.QueryEntities(ctx, entityTypes, entityAttributes, query, headers)
+	})
+}
+
+func (c *contextBrokerClient) RetrieveEntity(ctx context.Context, entityID string, headers map[string][]string) (types.Entity, error) {
+	return do(ctx, c, "retrieve", func(ctx context.Context) (types.Entity, error) {
+		return c.ContextBrokerClient.RetrieveEntity(ctx, entityID, headers)
+	})
+}
+
+func (c *contextBrokerClient) MergeEntity(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+	return do(ctx, c, "merge", func(ctx context.Context) (*ngsild.MergeEntityResult, error) {
+		return c.ContextBrokerClient.MergeEntity(ctx, entityID, fragment, headers)
+	})
+}
+
+func (c *contextBrokerClient) DeleteEntity(ctx context.Context, entityID string) (*ngsild.DeleteEntityResult, error) {
+	return do(ctx, c, "delete", func(ctx context.Context) (*ngsild.DeleteEntityResult, error) {
+		return c.ContextBrokerClient.DeleteEntity(ctx, entityID)
+	})
+}
@@ -0,0 +1,73 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// Policy decides how many times, and how often, a failed request is retried
+type Policy struct {
+	MaxRetries      int
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	// Timeout limits the duration of each attempt, zero means no limit
+	Timeout time.Duration
+}
+
+// ParsePolicy returns a policy with exponential backoff from initialInterval up to maxInterval
+func ParsePolicy(maxRetries, initialInterval, maxInterval, timeout string) (Policy, error) {
+	var err error
+	p := Policy{}
+
+	p.MaxRetries, err = strconv.Atoi(maxRetries)
+	if err != nil || p.MaxRetries < 0 {
+		return p, fmt.Errorf("invalid number of retries %q", maxRetries)
+	}
+
+	durations := []struct {
+		value string
+		d     *time.Duration
+	}{
+		{initialInterval, &p.InitialInterval},
+		{maxInterval, &p.MaxInterval},
+		{timeout, &p.Timeout},
+	}
+
+	for _, d := range durations {
+		*d.d, err = time.ParseDuration(d.value)
+		if err != nil || *d.d < 0 {
+			return p, fmt.Errorf("invalid duration %q", d.value)
+		}
+	}
+
+	if p.MaxRetries > 0 && (p.InitialInterval == 0 || p.MaxInterval < p.InitialInterval) {
+		return p, fmt.Errorf("max interval %s must be at least the initial interval %s, which must be greater than zero", maxInterval, initialInterval)
+	}
+
+	return p, nil
+}
+
+func (p Policy) backOff(ctx context.Context) backoff.BackOff {
+	b := backoff.NewExponentialBackOff(
+		backoff.WithInitialInterval(p.InitialInterval),
+		backoff.WithMaxInterval(p.MaxInterval),
+		backoff.WithMaxElapsedTime(0),
+	)
+	return backoff.WithContext(backoff.WithMaxRetries(b, uint64(p.MaxRetries)), ctx)
+}
+
+func wait(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,240 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	test "github.com/diwise/context-broker/pkg/test"
+	"github.com/matryer/is"
+)
+
+var testPolicy = Policy{MaxRetries: 3, InitialInterval: time.Millisecond, MaxInterval: 10 * time.Millisecond}
+
+func TestTransportRetriesServerErrors(t *testing.T) {
+	is := is.New(t)
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "payload" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c := http.Client{Transport: NewTransport(http.DefaultTransport, testPolicy)}
+
+	resp, err := c.Post(server.URL, "text/plain", strings.NewReader("payload"))
+	is.NoErr(err)
+	defer resp.Body.Close()
+
+	is.Equal(http.StatusOK, resp.StatusCode)
+	is.Equal(int32(3), calls.Load())
+}
+
+func TestTransportDoesNotRetryClientErrors(t *testing.T) {
+	is := is.New(t)
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	c := http.Client{Transport: NewTransport(http.DefaultTransport, testPolicy)}
+
+	resp, err := c.Get(server.URL)
+	is.NoErr(err)
+	resp.Body.Close()
+
+	is.Equal(http.StatusNotFound, resp.StatusCode)
+	is.Equal(int32(1), calls.Load())
+}
+
+func TestTransportGivesUpOnLongRetryAfter(t *testing.T) {
+	is := is.New(t)
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	c := http.Client{Transport: NewTransport(http.DefaultTransport, testPolicy)}
+
+	resp, err := c.Get(server.URL)
+	is.NoErr(err)
+	resp.Body.Close()
+
+	is.Equal(http.StatusTooManyRequests, resp.StatusCode)
+	is.Equal(int32(1), calls.Load())
+}
+
+func TestTransportRetriesTimeouts(t *testing.T) {
+	is := is.New(t)
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	policy := testPolicy
+	policy.Timeout = 50 * time.Millisecond
+
+	c := http.Client{Transport: NewTransport(http.DefaultTransport, policy)}
+
+	resp, err := c.Get(server.URL)
+	is.NoErr(err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	is.NoErr(err)
+	is.Equal("ok", string(body))
+	is.Equal(int32(2), calls.Load())
+}
+
+func TestRetryAfter(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(3*time.Second, retryAfter("3"))
+	is.Equal(time.Duration(0), retryAfter(""))
+	is.Equal(time.Duration(0), retryAfter("Wed, 21 Oct 2015 07:28:00 GMT")) // in the past
+}
+
+func TestContextBrokerRetriesUnreachableBroker(t *testing.T) {
+	is := is.New(t)
+
+	cbClient := &test.ContextBrokerClientMock{
+		MergeEntityFunc: func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+			if entityID == "urn:ngsi-ld:Beach:missing" {
+				return nil, ngsierrors.NewNotFoundError("not found")
+			}
+			return nil, fmt.Errorf("failed to send request: connection refused (%w)", ngsierrors.ErrRequest)
+		},
+	}
+
+	c := ContextBroker(cbClient, testPolicy, NewBreaker(2, time.Minute))
+
+	_, err := c.MergeEntity(context.Background(), "urn:ngsi-ld:Beach:missing", nil, nil)
+	is.True(errors.Is(err, ngsierrors.ErrNotFound))
+	is.Equal(1, len(cbClient.MergeEntityCalls())) // not found is an answer, not a failure
+
+	_, err = c.MergeEntity(context.Background(), "urn:ngsi-ld:Beach:1", nil, nil)
+	is.True(errors.Is(err, ngsierrors.ErrRequest))
+	is.Equal(1+4, len(cbClient.MergeEntityCalls()))
+
+	_, err = c.MergeEntity(context.Background(), "urn:ngsi-ld:Beach:2", nil, nil)
+	is.True(errors.Is(err, ngsierrors.ErrRequest))
+
+	calls := len(cbClient.MergeEntityCalls())
+
+	_, err = c.MergeEntity(context.Background(), "urn:ngsi-ld:Beach:3", nil, nil)
+	is.True(errors.Is(err, ErrCircuitOpen))
+	is.Equal(calls, len(cbClient.MergeEntityCalls())) // the request is not sent while the circuit is open
+}
+
+func TestContextBrokerTimesOutAttempts(t *testing.T) {
+	is := is.New(t)
+
+	cbClient := &test.ContextBrokerClientMock{
+		MergeEntityFunc: func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+			<-ctx.Done()
+			return nil, fmt.Errorf("failed to send request: %w (%w)", ctx.Err(), ngsierrors.ErrRequest)
+		},
+	}
+
+	policy := testPolicy
+	policy.Timeout = 10 * time.Millisecond
+
+	c := ContextBroker(cbClient, policy, NewBreaker(10, time.Minute))
+
+	_, err := c.MergeEntity(context.Background(), "urn:ngsi-ld:Beach:1", nil, nil)
+	is.True(errors.Is(err, context.DeadlineExceeded))
+	is.Equal(1+3, len(cbClient.MergeEntityCalls())) // each attempt times out and is retried
+}
+
+func TestContextBrokerWaitsForRateLimitBeforeTimeout(t *testing.T) {
+	is := is.New(t)
+
+	cbClient := &test.ContextBrokerClientMock{
+		MergeEntityFunc: func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+			return &ngsild.MergeEntityResult{}, ctx.Err()
+		},
+	}
+
+	policy := testPolicy
+	policy.Timeout = 10 * time.Millisecond
+
+	// a throttled request waits longer than the timeout before it is sent
+	throttle := func(ctx context.Context) error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}
+
+	c := ContextBroker(cbClient, policy, NewBreaker(1, time.Minute), RateLimit(throttle))
+
+	_, err := c.MergeEntity(context.Background(), "urn:ngsi-ld:Beach:1", nil, nil)
+	is.NoErr(err)
+	is.Equal(1, len(cbClient.MergeEntityCalls()))
+
+	// a cancelled wait is not a failure of the broker
+	cancelled := func(ctx context.Context) error { return context.Canceled }
+	c = ContextBroker(cbClient, policy, NewBreaker(1, time.Minute), RateLimit(cancelled))
+	_, err = c.MergeEntity(context.Background(), "urn:ngsi-ld:Beach:1", nil, nil)
+	is.True(errors.Is(err, context.Canceled))
+	_, err = c.MergeEntity(context.Background(), "urn:ngsi-ld:Beach:1", nil, nil)
+	is.True(!errors.Is(err, ErrCircuitOpen))
+}
+
+func TestBreakerClosesAfterCooldown(t *testing.T) {
+	is := is.New(t)
+
+	b := NewBreaker(1, 10*time.Millisecond)
+	b.Record(errors.New("unreachable"))
+	is.True(errors.Is(b.Allow(), ErrCircuitOpen))
+
+	time.Sleep(20 * time.Millisecond)
+	is.NoErr(b.Allow())
+
+	b.Record(nil)
+	is.NoErr(b.Allow())
+}
+
+func TestParsePolicy(t *testing.T) {
+	is := is.New(t)
+
+	p, err := ParsePolicy("3", "500ms", "30s", "10s")
+	is.NoErr(err)
+	is.Equal(Policy{MaxRetries: 3, InitialInterval: 500 * time.Millisecond, MaxInterval: 30 * time.Second, Timeout: 10 * time.Second}, p)
+
+	_, err = ParsePolicy("3", "1m", "30s", "0")
+	is.True(err != nil)
+
+	_, err = ParsePolicy("-1", "1s", "30s", "0")
+	is.True(err != nil)
+}
@@ -0,0 +1,140 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+)
+
+type transport struct {
+	next   http.RoundTripper
+	policy Policy
+}
+
+// NewTransport returns a transport that retries requests that fail with a transport error or time out,
+// as well as responses with status 429 Too Many Requests or a 5xx status other than 501 Not Implemented.
+// A Retry-After header is respected, unless it asks for a longer wait than the max interval of the policy.
+// Requests with a body are only retried if the body can be read again, see http.Request.GetBody.
+func NewTransport(next http.RoundTripper, policy Policy) http.RoundTripper {
+	return &transport{
+		next:   next,
+		policy: policy,
+	}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	logger := logging.GetFromContext(ctx)
+
+	b := t.policy.backOff(ctx)
+	canRetry := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+	for attempt := 1; ; attempt++ {
+		r := req
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(ctx)
+			r.Body = body
+		}
+
+		resp, err := t.attempt(r)
+
+		retryAfter, retryable := retryable(resp, err)
+		if !retryable || !canRetry || ctx.Err() != nil {
+			return resp, err
+		}
+
+		delay := b.NextBackOff()
+		if delay == backoff.Stop || retryAfter > t.policy.MaxInterval {
+			return resp, err
+		}
+		delay = max(delay, retryAfter)
+
+		var reason string
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		logger.Warn("request failed, retrying", slog.String("url", req.URL.Redacted()), slog.Int("attempt", attempt), slog.Duration("delay", delay), slog.String("reason", reason))
+
+		if err := wait(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt sends the request with the timeout of the policy. The timeout also covers reading the body
+// of the response, so it is not cancelled until the body is closed.
+func (t *transport) attempt(req *http.Request) (*http.Response, error) {
+	if t.policy.Timeout == 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.policy.Timeout)
+
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+
+	return resp, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// retryable reports whether a request should be retried and how long the server asked to wait, if at all
+func retryable(resp *http.Response, err error) (time.Duration, bool) {
+	if err != nil {
+		return 0, true
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusServiceUnavailable:
+		return retryAfter(resp.Header.Get("Retry-After")), true
+	case resp.StatusCode >= http.StatusInternalServerError && resp.StatusCode != http.StatusNotImplemented:
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// retryAfter parses a Retry-After header with either a number of seconds or an HTTP date
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0)
+	}
+
+	return 0
+}
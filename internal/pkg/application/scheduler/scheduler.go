@@ -0,0 +1,151 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+	"github.com/robfig/cron/v3"
+)
+
+var ErrAlreadyRunning = errors.New("job is already running")
+
+type Job func(ctx context.Context) error
+
+type Schedule interface {
+	// Next returns the next activation time, later than the given time
+	Next(time.Time) time.Time
+}
+
+type every struct {
+	interval time.Duration
+}
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(e.interval)
+}
+
+// ParseSchedule returns a schedule from a standard five field cron expression or, if the expression is empty, a fixed interval
+func ParseSchedule(interval, cronExpr string) (Schedule, error) {
+	if cronExpr != "" {
+		s, err := cron.ParseStandard(cronExpr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", cronExpr, err)
+		}
+		return s, nil
+	}
+
+	d, err := time.ParseDuration(interval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid interval %q: %w", interval, err)
+	}
+
+	if d <= 0 {
+		return nil, fmt.Errorf("interval must be greater than zero, got %s", interval)
+	}
+
+	return every{interval: d}, nil
+}
+
+type Scheduler struct {
+	job      Job
+	schedule Schedule
+	jitter   time.Duration
+	running  sync.Mutex
+}
+
+func New(job Job, schedule Schedule, jitter time.Duration) *Scheduler {
+	return &Scheduler{
+		job:      job,
+		schedule: schedule,
+		jitter:   jitter,
+	}
+}
+
+// Run runs the job once and then according to the schedule until ctx is cancelled. A job that is
+// running when ctx is cancelled is allowed to finish before Run returns.
+func (s *Scheduler) Run(ctx context.Context) error {
+	log := logging.GetFromContext(ctx)
+
+	s.runScheduled(ctx)
+
+	for {
+		next := s.schedule.Next(time.Now())
+		delay := time.Until(next) + s.randomJitter()
+
+		log.Debug("next job scheduled", slog.Time("at", time.Now().Add(delay)))
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Info("scheduler stopping, waiting for running job to finish")
+			s.Wait()
+			return nil
+		case <-timer.C:
+			s.runScheduled(ctx)
+		}
+	}
+}
+
+// Wait blocks until the running job, if any, has finished
+func (s *Scheduler) Wait() {
+	s.running.Lock()
+	s.running.Unlock()
+}
+
+// RunNow runs the job immediately, unless it is already running. The job is not cancelled
+// when ctx is, so that a job is never interrupted halfway through.
+func (s *Scheduler) RunNow(ctx context.Context) error {
+	if !s.running.TryLock() {
+		return ErrAlreadyRunning
+	}
+	defer s.running.Unlock()
+
+	return s.job(context.WithoutCancel(ctx))
+}
+
+// Start runs another job in the background, unless a job is already running. Jobs started this way
+// share the overlap protection of scheduled jobs, and Run waits for them to finish when it stops.
+func (s *Scheduler) Start(ctx context.Context, job Job) error {
+	if !s.running.TryLock() {
+		return ErrAlreadyRunning
+	}
+
+	go func() {
+		defer s.running.Unlock()
+
+		err := job(context.WithoutCancel(ctx))
+		if err != nil {
+			logging.GetFromContext(ctx).Error("job failed", "err", err.Error())
+		}
+	}()
+
+	return nil
+}
+
+func (s *Scheduler) runScheduled(ctx context.Context) {
+	log := logging.GetFromContext(ctx)
+
+	err := s.RunNow(ctx)
+	if err != nil {
+		if errors.Is(err, ErrAlreadyRunning) {
+			log.Warn("previous job is still running, skipping scheduled run")
+			return
+		}
+		log.Error("scheduled job failed", "err", err.Error())
+	}
+}
+
+func (s *Scheduler) randomJitter() time.Duration {
+	if s.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(s.jitter)))
+}
@@ -0,0 +1,93 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestParseSchedule(t *testing.T) {
+	is := is.New(t)
+
+	now := time.Date(2024, 6, 1, 10, 15, 0, 0, time.UTC)
+
+	s, err := ParseSchedule("30m", "")
+	is.NoErr(err)
+	is.Equal(now.Add(30*time.Minute), s.Next(now))
+
+	s, err = ParseSchedule("30m", "0 * * * *")
+	is.NoErr(err)
+	is.Equal(time.Date(2024, 6, 1, 11, 0, 0, 0, time.UTC), s.Next(now))
+
+	_, err = ParseSchedule("0s", "")
+	is.True(err != nil)
+
+	_, err = ParseSchedule("", "not a cron expression")
+	is.True(err != nil)
+}
+
+func TestRunNowPreventsOverlap(t *testing.T) {
+	is := is.New(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	s := New(func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}, every{interval: time.Hour}, 0)
+
+	done := make(chan error)
+	go func() { done <- s.RunNow(context.Background()) }()
+
+	<-started
+	is.True(errors.Is(s.RunNow(context.Background()), ErrAlreadyRunning))
+
+	close(release)
+	is.NoErr(<-done)
+}
+
+func TestRunLetsJobFinishOnShutdown(t *testing.T) {
+	is := is.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var finished atomic.Bool
+
+	s := New(func(jobCtx context.Context) error {
+		cancel()
+		time.Sleep(50 * time.Millisecond)
+		finished.Store(jobCtx.Err() == nil)
+		return nil
+	}, every{interval: time.Hour}, 0)
+
+	is.NoErr(s.Run(ctx))
+	is.True(finished.Load())
+}
+
+func TestStartSharesOverlapProtection(t *testing.T) {
+	is := is.New(t)
+
+	release := make(chan struct{})
+	done := make(chan struct{})
+
+	s := New(func(ctx context.Context) error { return nil }, every{interval: time.Hour}, 0)
+
+	err := s.Start(context.Background(), func(ctx context.Context) error {
+		<-release
+		close(done)
+		return nil
+	})
+	is.NoErr(err)
+
+	is.True(errors.Is(s.RunNow(context.Background()), ErrAlreadyRunning))
+	is.True(errors.Is(s.Start(context.Background(), func(ctx context.Context) error { return nil }), ErrAlreadyRunning))
+
+	close(release)
+	<-done
+}
@@ -2,8 +2,12 @@ package serviceguiden
 
 import (
 	"strings"
+	"time"
+	_ "time/tzdata"
 )
 
+const BadplatserServiceType string = "Badplatser"
+
 type ServiceGuiden struct {
 	Contents []Content `json:"content"`
 }
@@ -28,6 +32,7 @@ type Content struct {
 	AccessibilityURL string        `json:"accessibilityUrl"`
 	Deleted          bool          `json:"deleted"`
 	//Images           []Image       `json:"images"`
+	EventLogs        []EventLog    `json:"eventLogs,omitempty"`
 }
 
 /*
@@ -38,18 +43,25 @@ hemsida (siteUrl från service guide),
 besoksAdress (visitingAddress från service guide),
 */
 
-type Beach interface {
+type Site interface {
 	ID() string
 	Name() string
 	Description() string
 	WebSite() string
 	Address() string
-	Inriktning() string
-	BeachTypes() []string
 	AreaServed() string
 	AccessibilityUrl() string
 	Position() Position
 	BusinessId() int
+	LastModified() time.Time
+	Attributes() map[string][]string
+	ServiceTypeAttributes(serviceType string) map[string][]string
+}
+
+type Beach interface {
+	Site
+	Inriktning() string
+	BeachTypes() []string
 }
 
 func (r Content) Description() string {
@@ -98,6 +110,32 @@ func (r Content) Inriktning() string {
 	return strings.Join(attrs, ", ")
 }
 
+// Attributes returns the values of each attribute, for all service types
+func (r Content) Attributes() map[string][]string {
+	return r.attributes("")
+}
+
+// ServiceTypeAttributes returns the values of each attribute of a single service type, matched regardless of case
+func (r Content) ServiceTypeAttributes(serviceType string) map[string][]string {
+	return r.attributes(serviceType)
+}
+
+func (r Content) attributes(name string) map[string][]string {
+	attrs := map[string][]string{}
+	for _, serviceType := range r.ServiceTypes {
+		if name != "" && !strings.EqualFold(serviceType.Name, name) {
+			continue
+		}
+		for _, attr := range serviceType.Attributes {
+			name := strings.TrimSpace(attr.Name)
+			for _, v := range attr.Values {
+				attrs[name] = append(attrs[name], strings.TrimSpace(v.Name))
+			}
+		}
+	}
+	return attrs
+}
+
 func (r Content) BeachTypes() []string {
 	bt := strings.Split(r.Inriktning(), ",")
 	if len(bt) == 0 {
@@ -123,18 +161,62 @@ func (r Content) AreaServed() string {
 	return ""
 }
 
+// LastModified returns the time of the latest event in the event log, or a zero time if there are no events
+func (r Content) LastModified() time.Time {
+	var latest time.Time
+
+	for _, e := range r.EventLogs {
+		t, err := e.Time()
+		if err != nil {
+			continue
+		}
+		if t.After(latest) {
+			latest = t
+		}
+	}
+
+	return latest
+}
+
 func (r Content) IsBadplats() bool {
+	return r.IsServiceType(BadplatserServiceType)
+}
+
+// IsServiceType reports whether a site that has not been deleted has the given service type
+func (r Content) IsServiceType(name string) bool {
 	if r.Deleted {
 		return false
 	}
 	for _, serviceType := range r.ServiceTypes {
-		if strings.EqualFold(serviceType.Name, "Badplatser") {
+		if strings.EqualFold(serviceType.Name, name) {
 			return true
 		}
 	}
 	return false
 }
 
+type EventLog struct {
+	UserName      string `json:"userName"`
+	UserID        string `json:"userId"`
+	EventAction   string `json:"eventAction"`
+	EventDateTime string `json:"eventDateTime"`
+}
+
+// eventDateTime is given in local time without a zone
+const eventDateTimeLayout string = "2006-01-02 15:04:05"
+
+var eventDateTimeLocation = func() *time.Location {
+	loc, err := time.LoadLocation("Europe/Stockholm")
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}()
+
+func (e EventLog) Time() (time.Time, error) {
+	return time.ParseInLocation(eventDateTimeLayout, e.EventDateTime, eventDateTimeLocation)
+}
+
 type Organization struct {
 	ID         string `json:"id"`
 	Name       string `json:"name"`
@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/matryer/is"
 )
@@ -33,6 +34,29 @@ func TestBeachTypes(t *testing.T) {
 	is.Equal("Hav", content.BeachTypes()[0])
 }
 
+func TestAttributes(t *testing.T) {
+	is := is.New(t)
+	var content Content
+	err := json.Unmarshal([]byte(askimsbadet_json), &content)
+	is.NoErr(err)
+	attrs := content.Attributes()
+	is.Equal([]string{"Sandstrand", "Rullstolsramp ner i vattnet"}, attrs["Badservice"])
+	is.Equal([]string{"Nej"}, attrs["Hund tillåtet"])
+	_, ok := attrs["Nakenbad"]
+	is.True(!ok)
+}
+
+func TestServiceTypeAttributes(t *testing.T) {
+	is := is.New(t)
+	content := Content{ServiceTypes: []ServiceType{
+		{Name: "Utegym", Attributes: []Attribute{{Name: "Redskap", Values: []Value{{Name: "Chins"}}}}},
+		{Name: "Bollplaner", Attributes: []Attribute{{Name: "Underlag", Values: []Value{{Name: "Konstgräs"}}}}},
+	}}
+	attrs := content.ServiceTypeAttributes("bollplaner")
+	is.Equal(1, len(attrs))
+	is.Equal([]string{"Konstgräs"}, attrs["Underlag"])
+}
+
 func TestAreaServed(t *testing.T) {
 	is := is.New(t)
 	var content Content
@@ -49,6 +73,19 @@ func TestIsBadplats(t *testing.T) {
 	is.True(content.IsBadplats())
 }
 
+func TestLastModified(t *testing.T) {
+	is := is.New(t)
+	var content Content
+	err := json.Unmarshal([]byte(askimsbadet_json), &content)
+	is.NoErr(err)
+	is.Equal("2022-04-07T08:43:14Z", content.LastModified().UTC().Format(time.RFC3339))
+}
+
+func TestLastModifiedWithoutEventLogs(t *testing.T) {
+	is := is.New(t)
+	is.True(Content{}.LastModified().IsZero())
+}
+
 func TestUnmarshalServiceGuiden(t *testing.T) {
 	is := is.New(t)
 	f, err := os.Open("../../../../assets/test/serviceguiden_trim.json")
@@ -0,0 +1,181 @@
+package serviceguiden
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// ErrIncompleteContents is returned when the number of sites retrieved differs from the total reported by ServiceGuiden
+var ErrIncompleteContents = errors.New("incomplete contents from serviceguiden")
+
+// page is a response with Spring style pagination metadata. The metadata is missing when all contents
+// are returned at once, in which case the response is treated as the last page.
+type page struct {
+	Contents      []json.RawMessage `json:"content"`
+	Number        *int              `json:"number"`
+	TotalPages    *int              `json:"totalPages"`
+	TotalElements *int              `json:"totalElements"`
+	Last          *bool             `json:"last"`
+}
+
+func (p page) number() int {
+	if p.Number == nil {
+		return -1
+	}
+	return *p.Number
+}
+
+func (p page) isLast() bool {
+	if p.Last != nil {
+		return *p.Last
+	}
+	if p.Number != nil && p.TotalPages != nil {
+		return *p.Number+1 >= *p.TotalPages
+	}
+	return true
+}
+
+// getPagesSequentially follows the pages after the first one until the last page
+func (sgc client) getPagesSequentially(ctx context.Context, first page) ([]json.RawMessage, error) {
+	contents := []json.RawMessage{}
+
+	for p := first; !p.isLast(); {
+		next := p.number() + 1
+
+		pageUrl, err := sgc.pageUrl(next)
+		if err != nil {
+			return nil, err
+		}
+
+		p, err = sgc.getPage(ctx, pageUrl)
+		if err != nil {
+			return nil, err
+		}
+
+		// a server that ignores the page parameter would otherwise be asked for the same page forever
+		if p.number() != next {
+			return nil, fmt.Errorf("failed to retrieve page %d from serviceguiden, got page %d", next, p.number())
+		}
+
+		contents = append(contents, p.Contents...)
+	}
+
+	return contents, nil
+}
+
+// getPagesConcurrently retrieves the pages from first up to, but not including, totalPages and keeps them in order
+func (sgc client) getPagesConcurrently(ctx context.Context, first, totalPages int) ([]json.RawMessage, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pages := make([][]json.RawMessage, max(totalPages-first, 0))
+	sem := make(chan struct{}, sgc.pageConcurrency)
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	for i := range pages {
+		sem <- struct{}{}
+
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			pageUrl, err := sgc.pageUrl(first + i)
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			p, err := sgc.getPage(ctx, pageUrl)
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			pages[i] = p.Contents
+		}(i)
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	contents := []json.RawMessage{}
+	for _, p := range pages {
+		contents = append(contents, p...)
+	}
+
+	return contents, nil
+}
+
+// pageUrl returns the service url with the page parameter set, keeping any other parameters such as size
+func (sgc client) pageUrl(number int) (string, error) {
+	u, err := url.Parse(sgc.serviceUrl)
+	if err != nil {
+		return "", fmt.Errorf("invalid serviceguiden url: %w", err)
+	}
+
+	q := u.Query()
+	q.Set("page", strconv.Itoa(number))
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+func (sgc client) getPage(ctx context.Context, pageUrl string) (page, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageUrl, nil)
+	if err != nil {
+		return page{}, err
+	}
+
+	resp, err := sgc.httpClient.Do(req)
+	if err != nil {
+		return page{}, fmt.Errorf("failed to retrieve data from serviceguiden: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return page{}, fmt.Errorf("failed to retrieve data from serviceguiden, expected status code %d, but got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return page{}, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var p page
+
+	err = json.Unmarshal(body, &p)
+	if err != nil {
+		return page{}, fmt.Errorf("failed to unmarshal data: %w", err)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,80 @@
+package serviceguiden
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestAllPagesAreRetrieved(t *testing.T) {
+	for _, concurrency := range []int{1, 3} {
+		t.Run(fmt.Sprintf("concurrency %d", concurrency), func(t *testing.T) {
+			is := is.New(t)
+			ctx := context.Background()
+
+			server := pagedServer(t, 7, 3, 7)
+			defer server.Close()
+
+			c := newClient(server.URL+"?size=3", PageConcurrency(concurrency))
+			contents, err := c.Get(ctx)
+			is.NoErr(err)
+
+			ids := []string{}
+			for _, c := range contents {
+				ids = append(ids, c.ID())
+			}
+			is.Equal(strings.Join(ids, ","), "0,1,2,3,4,5,6")
+		})
+	}
+}
+
+func TestMissingSitesAreReported(t *testing.T) {
+	is := is.New(t)
+
+	server := pagedServer(t, 7, 3, 8)
+	defer server.Close()
+
+	_, err := newClient(server.URL + "?size=3").Get(context.Background())
+	is.True(errors.Is(err, ErrIncompleteContents))
+}
+
+func TestResponseWithoutPagination(t *testing.T) {
+	is := is.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"content":[{"id":"1"},{"id":"2"}]}`))
+	}))
+	defer server.Close()
+
+	contents, err := newClient(server.URL).Get(context.Background())
+	is.NoErr(err)
+	is.Equal(len(contents), 2)
+}
+
+// pagedServer serves sites in pages of size, reporting totalElements as the total
+func pagedServer(t *testing.T, sites, size, totalElements int) *httptest.Server {
+	totalPages := (sites + size - 1) / size
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("size") != strconv.Itoa(size) {
+			t.Errorf("expected size to be kept in %s", r.URL)
+		}
+
+		number, _ := strconv.Atoi(r.URL.Query().Get("page"))
+
+		content := []string{}
+		for i := number * size; i < min((number+1)*size, sites); i++ {
+			content = append(content, fmt.Sprintf(`{"id":"%d"}`, i))
+		}
+
+		fmt.Fprintf(w, `{"content":[%s],"number":%d,"size":%d,"totalPages":%d,"totalElements":%d,"last":%t}`,
+			strings.Join(content, ","), number, size, totalPages, totalElements, number+1 >= totalPages)
+	}))
+}
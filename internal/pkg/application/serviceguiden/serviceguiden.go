@@ -8,7 +8,11 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/health"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/metrics"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/retry"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
@@ -17,24 +21,58 @@ import (
 
 type ServiceGuidenClient interface {
 	Badplatser(ctx context.Context) ([]Beach, error)
+	Sites(ctx context.Context, serviceType string) ([]Site, error)
 }
 
 type client struct {
-	serviceUrl string
-	badplatser []Beach
-	contents   []Content
+	serviceUrl      string
+	httpClient      http.Client
+	pageConcurrency int
+	badplatser      []Beach
+	contents        []Content
 }
 
-func New(ctx context.Context, url, filePath string) ServiceGuidenClient {
-	c, err := loadContentsFromFile(ctx, filePath)
+// RetryPolicy retries requests to ServiceGuiden according to the policy
+func RetryPolicy(policy retry.Policy) func(*client) {
+	return func(c *client) {
+		c.httpClient.Transport = otelhttp.NewTransport(retry.NewTransport(http.DefaultTransport, policy))
+	}
+}
+
+// PageConcurrency sets how many pages are retrieved at the same time when the response is paginated
+func PageConcurrency(n int) func(*client) {
+	return func(c *client) {
+		c.pageConcurrency = n
+	}
+}
+
+// New creates a client for the ServiceGuiden API. If filePath points to a file with ServiceGuiden contents, such as
+// a snapshot, the contents are read from the file instead of the API.
+func New(ctx context.Context, url, filePath string, options ...func(*client)) ServiceGuidenClient {
+	contents, err := loadContentsFromFile(ctx, filePath)
 	if err != nil {
-		c = []Content{}
+		contents = []Content{}
 	}
 
-	return &client{
+	c := newClient(url, options...)
+	c.contents = contents
+
+	return c
+}
+
+func newClient(url string, options ...func(*client)) *client {
+	c := &client{
 		serviceUrl: url,
-		contents:   c,
+		httpClient: http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
 	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
 }
 
 func loadContentsFromFile(ctx context.Context, filePath string) (content []Content, err error) {
@@ -54,7 +92,12 @@ func loadContentsFromFile(ctx context.Context, filePath string) (content []Conte
 	}
 	defer f.Close()
 
-	b, err := io.ReadAll(f)
+	r, err := uncompress(f)
+	if err != nil {
+		return
+	}
+
+	b, err := io.ReadAll(r)
 	if err != nil {
 		return
 	}
@@ -76,44 +119,60 @@ func loadContentsFromFile(ctx context.Context, filePath string) (content []Conte
 var tracer = otel.Tracer("integration-cip-gbg-ms/serviceguiden")
 
 func (sgc client) Get(ctx context.Context) ([]Content, error) {
-	var err error
+	raw, err := sgc.getRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	ctx, span := tracer.Start(ctx, "integration-cip-gbg-ms/serviceguiden/get")
-	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+	contents := make([]Content, 0, len(raw))
 
-	httpClient := http.Client{
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
+	for _, r := range raw {
+		var c Content
+		err = json.Unmarshal(r, &c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal data: %w", err)
+		}
+		contents = append(contents, c)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sgc.serviceUrl, nil)
+	return contents, nil
+}
+
+// getRaw retrieves the contents without decoding them, so that fields that are not used by the integration are kept.
+// If the response is paginated, every page is retrieved and the number of sites is checked against the total.
+func (sgc client) getRaw(ctx context.Context) (contents []json.RawMessage, err error) {
+	ctx, span := tracer.Start(ctx, "integration-cip-gbg-ms/serviceguiden/get")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	first, err := sgc.getPage(ctx, sgc.serviceUrl)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve data from serviceguiden: %w", err)
-	}
+	contents = first.Contents
 
-	defer resp.Body.Close()
+	if !first.isLast() {
+		var rest []json.RawMessage
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to retrieve data from serviceguiden, expected status code %d, but got %d", http.StatusOK, resp.StatusCode)
-	}
+		if sgc.pageConcurrency > 1 && first.Number != nil && first.TotalPages != nil {
+			rest, err = sgc.getPagesConcurrently(ctx, first.number()+1, *first.TotalPages)
+		} else {
+			rest, err = sgc.getPagesSequentially(ctx, first)
+		}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
+		if err != nil {
+			return nil, err
+		}
 
-	var serviceGuidenData ServiceGuiden
+		contents = append(contents, rest...)
+	}
 
-	err = json.Unmarshal(body, &serviceGuidenData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal data: %w", err)
+	if first.TotalElements != nil && len(contents) != *first.TotalElements {
+		err = fmt.Errorf("%w, expected %d sites but got %d", ErrIncompleteContents, *first.TotalElements, len(contents))
+		return nil, err
 	}
 
-	return serviceGuidenData.Contents, err
+	return contents, nil
 }
 
 func (sgc *client) Badplatser(ctx context.Context) ([]Beach, error) {
@@ -124,18 +183,9 @@ func (sgc *client) Badplatser(ctx context.Context) ([]Beach, error) {
 		return sgc.badplatser, nil
 	}
 
-	if len(sgc.contents) == 0 {
-		logger.Debug("need to fetch contents from serviceguiden API")
-
-		content, err := sgc.Get(ctx)
-		if err != nil {
-			return nil, err
-		}
-		sgc.contents = content
-
-		logger.Debug("contents fetched from ServiceGuiden", slog.Int("count", len(sgc.contents)))
-	} else {
-		logger.Debug("contents previously loaded")
+	err := sgc.ensureContents(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	for _, c := range sgc.contents {
@@ -148,3 +198,50 @@ func (sgc *client) Badplatser(ctx context.Context) ([]Beach, error) {
 
 	return sgc.badplatser, nil
 }
+
+// Sites returns all sites, that have not been deleted, with the given service type
+func (sgc *client) Sites(ctx context.Context, serviceType string) ([]Site, error) {
+	logger := logging.GetFromContext(ctx)
+
+	err := sgc.ensureContents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sites := []Site{}
+
+	for _, c := range sgc.contents {
+		if c.IsServiceType(serviceType) {
+			sites = append(sites, c)
+		}
+	}
+
+	logger.Debug("sites found", slog.String("service_type", serviceType), slog.Int("count", len(sites)))
+
+	return sites, nil
+}
+
+func (sgc *client) ensureContents(ctx context.Context) error {
+	logger := logging.GetFromContext(ctx)
+
+	if len(sgc.contents) > 0 {
+		logger.Debug("contents previously loaded")
+		return nil
+	}
+
+	logger.Debug("need to fetch contents from serviceguiden API")
+
+	start := time.Now()
+	content, err := sgc.Get(ctx)
+	metrics.ServiceGuidenRequest(ctx, start, err)
+	health.ServiceGuiden.Attempt(err)
+
+	if err != nil {
+		return err
+	}
+	sgc.contents = content
+
+	logger.Debug("contents fetched from ServiceGuiden", slog.Int("count", len(sgc.contents)))
+
+	return nil
+}
@@ -0,0 +1,234 @@
+package serviceguiden
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Snapshot is a copy of the ServiceGuiden contents at a point in time. It is stored in the same format as the
+// API response, with a few extra fields, so that it can be replayed by a client created with the snapshot file.
+type Snapshot struct {
+	TakenAt      time.Time         `json:"takenAt"`
+	Source       string            `json:"source"`
+	ServiceTypes []string          `json:"serviceTypes,omitempty"`
+	Redacted     bool              `json:"redacted"`
+	Contents     []json.RawMessage `json:"content"`
+}
+
+// SnapshotOptions decides what is kept in a snapshot. All service types are kept if none are given.
+type SnapshotOptions struct {
+	ServiceTypes []string
+	Redact       bool
+}
+
+// TakeSnapshot fetches the contents from the ServiceGuiden API, keeping every field of the response
+func TakeSnapshot(ctx context.Context, url string, opts SnapshotOptions, options ...func(*client)) (*Snapshot, error) {
+	c := newClient(url, options...)
+
+	raw, err := c.getRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{
+		TakenAt:  time.Now().UTC(),
+		Source:   url,
+		Contents: raw,
+	}
+
+	if len(opts.ServiceTypes) > 0 {
+		err = s.Trim(opts.ServiceTypes...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Redact {
+		err = s.Redact()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Sites decodes the contents of the snapshot, including sites that have been deleted
+func (s *Snapshot) Sites() ([]Content, error) {
+	sites := make([]Content, 0, len(s.Contents))
+
+	for _, raw := range s.Contents {
+		var c Content
+		err := json.Unmarshal(raw, &c)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode site: %w", err)
+		}
+		sites = append(sites, c)
+	}
+
+	return sites, nil
+}
+
+// Trim removes every site that does not have any of the service types. Deleted sites are kept so that
+// the snapshot shows that they have been deleted.
+func (s *Snapshot) Trim(serviceTypes ...string) error {
+	kept := make([]json.RawMessage, 0, len(s.Contents))
+
+	for _, raw := range s.Contents {
+		var c Content
+		err := json.Unmarshal(raw, &c)
+		if err != nil {
+			return fmt.Errorf("unable to decode site: %w", err)
+		}
+
+		if hasAnyServiceType(c, serviceTypes) {
+			kept = append(kept, raw)
+		}
+	}
+
+	s.Contents = kept
+	s.ServiceTypes = append(s.ServiceTypes, serviceTypes...)
+
+	return nil
+}
+
+func hasAnyServiceType(c Content, names []string) bool {
+	for _, serviceType := range c.ServiceTypes {
+		for _, name := range names {
+			if strings.EqualFold(serviceType.Name, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Redact removes personal data, i.e. the names, phone numbers and email addresses of contacts and the users
+// in the event log. Contact centers are not persons and are kept as they are.
+func (s *Snapshot) Redact() error {
+	for i, raw := range s.Contents {
+		d := json.NewDecoder(bytes.NewReader(raw))
+		d.UseNumber()
+
+		site := map[string]any{}
+		err := d.Decode(&site)
+		if err != nil {
+			return fmt.Errorf("unable to decode site: %w", err)
+		}
+
+		if contacts, ok := site["contacts"].([]any); ok {
+			for _, contact := range contacts {
+				if c, ok := contact.(map[string]any); ok && c["contactCenter"] != true {
+					redactFields(c, "name", "email")
+					redactContactMethods(c, "phone", "mobilePhone")
+				}
+			}
+		}
+
+		if events, ok := site["eventLogs"].([]any); ok {
+			for _, event := range events {
+				if e, ok := event.(map[string]any); ok {
+					redactFields(e, "userName", "userId")
+				}
+			}
+		}
+
+		s.Contents[i], err = json.Marshal(site)
+		if err != nil {
+			return fmt.Errorf("unable to encode site: %w", err)
+		}
+	}
+
+	s.Redacted = true
+
+	return nil
+}
+
+func redactFields(m map[string]any, names ...string) {
+	for _, name := range names {
+		if _, ok := m[name]; ok {
+			m[name] = ""
+		}
+	}
+}
+
+func redactContactMethods(m map[string]any, names ...string) {
+	for _, name := range names {
+		if method, ok := m[name].(map[string]any); ok {
+			redactFields(method, "e164", "display")
+		}
+	}
+}
+
+// FileName returns a name for the snapshot file based on the time it was taken, e.g. serviceguiden-20240815T120000Z.json.gz
+func (s *Snapshot) FileName(compress bool) string {
+	name := fmt.Sprintf("serviceguiden-%s.json", s.TakenAt.UTC().Format("20060102T150405Z"))
+	if compress {
+		name += ".gz"
+	}
+	return name
+}
+
+// Write writes the snapshot as JSON, optionally gzip compressed
+func (s *Snapshot) Write(w io.Writer, compress bool) error {
+	if !compress {
+		return json.NewEncoder(w).Encode(s)
+	}
+
+	zw := gzip.NewWriter(w)
+	zw.ModTime = s.TakenAt
+
+	err := json.NewEncoder(zw).Encode(s)
+	if err != nil {
+		zw.Close()
+		return err
+	}
+
+	return zw.Close()
+}
+
+// LoadSnapshot reads a snapshot, or any file with ServiceGuiden contents, that may be gzip compressed
+func LoadSnapshot(filePath string) (*Snapshot, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := uncompress(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read snapshot %s: %w", filePath, err)
+	}
+
+	s := &Snapshot{}
+	err = json.NewDecoder(r).Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode snapshot %s: %w", filePath, err)
+	}
+
+	return s, nil
+}
+
+// uncompress returns a reader of the uncompressed contents, whether the file is gzip compressed or not
+func uncompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+
+	return br, nil
+}
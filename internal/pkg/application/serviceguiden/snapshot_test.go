@@ -0,0 +1,72 @@
+package serviceguiden
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestSnapshotCanBeReplayed(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"content":[` + askimsbadet_json + `,{"id":"1","name":"Bibliotek","serviceTypes":[{"id":"2","name":"Bibliotek"}]}]}`))
+	}))
+	defer server.Close()
+
+	snapshot, err := TakeSnapshot(ctx, server.URL, SnapshotOptions{ServiceTypes: []string{"badplatser"}, Redact: true})
+	is.NoErr(err)
+	is.Equal(len(snapshot.Contents), 1)
+	is.True(snapshot.Redacted)
+
+	for _, compress := range []bool{false, true} {
+		filePath := filepath.Join(t.TempDir(), snapshot.FileName(compress))
+		f, err := os.Create(filePath)
+		is.NoErr(err)
+		is.NoErr(snapshot.Write(f, compress))
+		is.NoErr(f.Close())
+
+		loaded, err := LoadSnapshot(filePath)
+		is.NoErr(err)
+		is.Equal(loaded.ServiceTypes, []string{"badplatser"})
+
+		// the url is never used since the contents are read from the snapshot
+		beaches, err := New(ctx, "http://localhost:0", filePath).Badplatser(ctx)
+		is.NoErr(err)
+		is.Equal(len(beaches), 1)
+		is.Equal(beaches[0].Name(), "Askimsbadet")
+		is.Equal(beaches[0].BeachTypes(), []string{"Hav"})
+	}
+}
+
+func TestRedactRemovesPersonalData(t *testing.T) {
+	is := is.New(t)
+
+	snapshot := &Snapshot{Contents: []json.RawMessage{[]byte(`{
+		"id": "1",
+		"businessId": 1234,
+		"contacts": [
+			{"id": "a", "name": "Anna Andersson", "email": "anna@example.com", "phone": {"e164": "+4631000000", "display": "031-00 00 00"}, "contactCenter": false},
+			{"id": "b", "name": "Kontaktcenter", "phone": {"e164": "+4631365000", "display": "031-365 00 00"}, "contactCenter": true}
+		],
+		"eventLogs": [{"userName": "Anna Andersson", "userId": "anna01", "eventAction": "UPDATED", "eventDateTime": "2022-04-07 10:43:14"}]
+	}`)}}
+
+	is.NoErr(snapshot.Redact())
+
+	redacted := string(snapshot.Contents[0])
+	is.True(!strings.Contains(redacted, "Anna"))
+	is.True(!strings.Contains(redacted, "anna"))
+	is.True(!strings.Contains(redacted, "+4631000000"))
+	is.True(strings.Contains(redacted, "031-365 00 00"))
+	is.True(strings.Contains(redacted, `"businessId":1234`))
+	is.True(strings.Contains(redacted, "2022-04-07 10:43:14"))
+}
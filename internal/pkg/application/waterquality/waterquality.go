@@ -0,0 +1,105 @@
+package waterquality
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/diwise/context-broker/pkg/datamodels/fiware"
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/cip"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/hav"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/report"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/serviceguiden"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+)
+
+// Beach is a published Beach entity with a known NUTS code
+type Beach struct {
+	ID       string
+	NutsCode string
+	Position serviceguiden.Position
+}
+
+type Options struct {
+	// Samples is the number of most recent samples to publish for each beach
+	Samples int
+	// DryRun reports which observations would be created without creating them
+	DryRun bool
+}
+
+// Sync fetches the latest sample results for each beach and creates a WaterQualityObserved entity for each
+// sample that has not been published before. Observations are never changed once they have been created.
+// A profile that cannot be fetched is reported as a warning on the beach, since the samples can be fetched
+// again in the next run.
+func Sync(ctx context.Context, havClient hav.Client, cbClient client.ContextBrokerClient, beaches []Beach, opts Options, rpt *report.Report) error {
+	logger := logging.GetFromContext(ctx)
+
+	errs := []error{}
+
+	for _, b := range beaches {
+		profile, err := havClient.Profile(ctx, b.NutsCode)
+		if err != nil {
+			logger.Warn("failed to fetch bathing water profile", slog.String("beach_id", b.ID), slog.String("nuts_code", b.NutsCode), slog.String("err", err.Error()))
+			rpt.Entity(b.ID, "").Warn(fmt.Sprintf("could not fetch bathing water profile %s: %s", b.NutsCode, err.Error()))
+			continue
+		}
+
+		for _, sample := range profile.Latest(opts.Samples) {
+			id := cip.WaterQualityObservedID(b.NutsCode, sample)
+
+			entry := rpt.Entity(id, b.NutsCode)
+			entry.Type = fiware.WaterQualityObservedTypeName
+			entry.Name = profile.LocationName
+
+			err = create(ctx, cbClient, id, cip.NewWaterQualityObservedProps(b.ID, b.Position, b.NutsCode, sample), opts.DryRun, entry)
+			if err != nil {
+				logger.Error("failed to create water quality observation", slog.String("entity_id", id), slog.String("err", err.Error()))
+				entry.Fail(err)
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func create(ctx context.Context, cbClient client.ContextBrokerClient, id string, props []entities.EntityDecoratorFunc, dryRun bool, entry *report.Entity) error {
+	if dryRun {
+		exists, err := cip.EntityExists(ctx, cbClient, id)
+		if err != nil {
+			return err
+		}
+
+		entry.Outcome = report.Created
+		if exists {
+			entry.Outcome = report.Unchanged
+		}
+
+		return nil
+	}
+
+	entity, err := entities.New(id, fiware.WaterQualityObservedTypeName, props...)
+	if err != nil {
+		return fmt.Errorf("failed to create new entity props for entity %s, %w", id, err)
+	}
+
+	headers := map[string][]string{"Content-Type": {"application/ld+json"}}
+
+	_, err = cbClient.CreateEntity(ctx, entity, headers)
+	if err != nil {
+		if errors.Is(err, ngsierrors.ErrAlreadyExists) {
+			entry.Outcome = report.Unchanged
+			return nil
+		}
+		return fmt.Errorf("failed to create entity %s, %w", id, err)
+	}
+
+	entry.Outcome = report.Created
+
+	return nil
+}
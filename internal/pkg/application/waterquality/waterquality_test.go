@@ -0,0 +1,86 @@
+package waterquality
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	test "github.com/diwise/context-broker/pkg/test"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/hav"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/report"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/serviceguiden"
+	"github.com/matryer/is"
+)
+
+func TestSyncCreatesObservationsOnce(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(profileJSON))
+	}))
+	defer server.Close()
+
+	existingID := "urn:ngsi-ld:WaterQualityObserved:SE0A21480000000532:20240701T080000Z"
+
+	cbClient := &test.ContextBrokerClientMock{
+		CreateEntityFunc: func(ctx context.Context, entity types.Entity, headers map[string][]string) (*ngsild.CreateEntityResult, error) {
+			if entity.ID() == existingID {
+				return nil, ngsierrors.NewAlreadyExistsError("already exists")
+			}
+			return &ngsild.CreateEntityResult{}, nil
+		},
+	}
+
+	beaches := []Beach{
+		{ID: "urn:ngsi-ld:Beach:askim", NutsCode: "SE0A21480000000532", Position: serviceguiden.Position{Latitude: 57.62, Longitude: 11.92}},
+	}
+
+	rpt := report.New(false)
+
+	err := Sync(ctx, hav.NewClient(server.URL), cbClient, beaches, Options{Samples: 2}, rpt)
+	is.NoErr(err)
+
+	is.Equal(2, len(cbClient.CreateEntityCalls()))
+	is.Equal(1, rpt.Count(report.Created))
+	is.Equal(1, rpt.Count(report.Unchanged))
+
+	created := cbClient.CreateEntityCalls()[0].Entity
+	is.Equal("urn:ngsi-ld:WaterQualityObserved:SE0A21480000000532:20240715T080000Z", created.ID())
+
+	b, _ := created.MarshalJSON()
+	is.True(strings.Contains(string(b), `"refPointOfInterest":{"type":"Relationship","object":"urn:ngsi-ld:Beach:askim"}`))
+	is.True(strings.Contains(string(b), `"temperature":{"type":"Property","value":18.5}`))
+}
+
+func TestSyncWarnsWhenProfileIsMissing(t *testing.T) {
+	is := is.New(t)
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	cbClient := &test.ContextBrokerClientMock{}
+	rpt := report.New(false)
+
+	err := Sync(context.Background(), hav.NewClient(server.URL), cbClient, []Beach{{ID: "urn:ngsi-ld:Beach:askim", NutsCode: "SE0A21480000000532"}}, Options{Samples: 1}, rpt)
+	is.NoErr(err)
+
+	is.Equal(0, len(cbClient.CreateEntityCalls()))
+	is.Equal(1, rpt.Warnings())
+}
+
+const profileJSON string = `{
+	"nutsCode": "SE0A21480000000532",
+	"locationName": "Askimsbadet",
+	"sampleResults": [
+		{"sampleDate": 1719820800000, "waterTemp": 17, "escherichiaColiPrefix": "<", "escherichiaColiCount": 10, "intestinalEnterococciCount": 20, "sampleAssessIdText": "Tjänligt"},
+		{"sampleDate": 1721030400000, "waterTemp": 18.5, "escherichiaColiCount": 100, "intestinalEnterococciPrefix": "<", "intestinalEnterococciCount": 10, "sampleAssessIdText": "Tjänligt med anmärkning"},
+		{"sampleDate": 1717200000000, "waterTemp": 15}
+	]
+}`
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+	"github.com/go-chi/chi/v5"
+
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/health"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/pipeline"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/report"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/scheduler"
+)
+
+// Syncer starts and inspects syncs on behalf of the admin API
+type Syncer interface {
+	// Start starts a sync in the background, for a single site if sourceID is not empty. It returns
+	// scheduler.ErrAlreadyRunning if a sync is already running, and pipeline.ErrSiteNotFound if there is
+	// no site with sourceID.
+	Start(ctx context.Context, sourceID string) error
+	// LastReport returns the report of the last sync, or nil if there has not been any sync yet
+	LastReport() *report.Report
+	// Preview returns the beach entities that a sync would publish
+	Preview(ctx context.Context, sourceID string) ([]types.Entity, error)
+}
+
+// HealthChecker reports whether the service is ready
+type HealthChecker interface {
+	Check() health.Status
+}
+
+type syncRequest struct {
+	ID string `json:"id"`
+}
+
+// New returns a router with the admin and health endpoints
+func New(ctx context.Context, syncer Syncer, checker HealthChecker) *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/health/live", live)
+	r.Get("/health/ready", ready(checker))
+
+	r.Post("/sync", startSync(ctx, syncer))
+	r.Get("/sync/last", lastReport(syncer))
+	r.Get("/beaches", previewBeaches(syncer))
+
+	return r
+}
+
+// startSync starts a sync of all sites, or of the site given by the query parameter id or an id in the request body
+func startSync(ctx context.Context, syncer Syncer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetFromContext(ctx)
+
+		req := syncRequest{ID: r.URL.Query().Get("id")}
+
+		if req.ID == "" && r.ContentLength != 0 {
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// the sync outlives the request, so it is started with the context of the server
+		err := syncer.Start(ctx, req.ID)
+		if err != nil {
+			if errors.Is(err, scheduler.ErrAlreadyRunning) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			if errors.Is(err, pipeline.ErrSiteNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			logger.Error("failed to start sync", slog.String("id", req.ID), "err", err.Error())
+			http.Error(w, "failed to start sync", http.StatusInternalServerError)
+			return
+		}
+
+		logger.Info("sync started", slog.String("id", req.ID))
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, health.Check{Status: health.Up})
+}
+
+// ready responds with the status of each check, with 503 Service Unavailable if the service is not ready.
+// A degraded service is still ready.
+func ready(checker HealthChecker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := checker.Check()
+
+		code := http.StatusOK
+		if status.Status == health.NotReady {
+			code = http.StatusServiceUnavailable
+		}
+
+		writeJSON(w, code, status)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(b)
+}
+
+func lastReport(syncer Syncer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rpt := syncer.LastReport()
+		if rpt == nil {
+			http.Error(w, "no sync has completed yet", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		rpt.WriteJSON(w)
+	}
+}
+
+// previewBeaches returns the beach entities a sync would publish, or only the beach given by the query parameter id
+func previewBeaches(syncer Syncer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.GetFromContext(r.Context())
+
+		beaches, err := syncer.Preview(r.Context(), r.URL.Query().Get("id"))
+		if err != nil {
+			if errors.Is(err, pipeline.ErrSiteNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			logger.Error("failed to preview beaches", "err", err.Error())
+			http.Error(w, "failed to preview beaches", http.StatusBadGateway)
+			return
+		}
+
+		b, err := json.Marshal(beaches)
+		if err != nil {
+			http.Error(w, "failed to marshal beaches", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/ld+json")
+		w.Write(b)
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+	"github.com/matryer/is"
+
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/health"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/pipeline"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/report"
+	"github.com/diwise/integration-cip-gbg-ms/internal/pkg/application/scheduler"
+)
+
+func TestStartSync(t *testing.T) {
+	is := is.New(t)
+
+	syncer := &syncerMock{}
+	r := New(context.Background(), syncer, &checkerMock{})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/sync?id=61e0a244cfc4d247cca95f4e", nil))
+	is.Equal(http.StatusAccepted, w.Code)
+	is.Equal([]string{"61e0a244cfc4d247cca95f4e"}, syncer.started)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/sync", strings.NewReader(`{"id":"61e0a252cfc4d247cca9698b"}`)))
+	is.Equal(http.StatusAccepted, w.Code)
+	is.Equal("61e0a252cfc4d247cca9698b", syncer.started[1])
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/sync", nil))
+	is.Equal(http.StatusAccepted, w.Code)
+	is.Equal("", syncer.started[2])
+}
+
+func TestStartSyncWhileRunning(t *testing.T) {
+	is := is.New(t)
+
+	r := New(context.Background(), &syncerMock{startErr: scheduler.ErrAlreadyRunning}, &checkerMock{})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/sync", nil))
+	is.Equal(http.StatusConflict, w.Code)
+}
+
+func TestStartSyncOfUnknownSite(t *testing.T) {
+	is := is.New(t)
+
+	syncer := &syncerMock{}
+	r := New(context.Background(), syncer, &checkerMock{})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/sync?id=unknown", nil))
+	is.Equal(http.StatusNotFound, w.Code)
+	is.Equal(0, len(syncer.started))
+}
+
+func TestLastReport(t *testing.T) {
+	is := is.New(t)
+
+	syncer := &syncerMock{}
+	r := New(context.Background(), syncer, &checkerMock{})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sync/last", nil))
+	is.Equal(http.StatusNotFound, w.Code)
+
+	syncer.last = report.New(false)
+	entry := syncer.last.Entity("urn:ngsi-ld:Beach:se:goteborg:askim", "61e0a244cfc4d247cca95f4e")
+	entry.Fail(fmt.Errorf("failed to merge entity"))
+	syncer.last.Finish()
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sync/last", nil))
+	is.Equal(http.StatusOK, w.Code)
+
+	var rpt report.Report
+	is.NoErr(json.NewDecoder(w.Body).Decode(&rpt))
+	is.Equal(report.Failed, rpt.Entities[0].Outcome)
+	is.Equal([]string{"failed to merge entity"}, rpt.Entities[0].Errors)
+}
+
+func TestPreviewBeaches(t *testing.T) {
+	is := is.New(t)
+
+	askim, _ := entities.New("urn:ngsi-ld:Beach:se:goteborg:askim", "Beach", decorators.Name("Askimsbadet"))
+	r := New(context.Background(), &syncerMock{beaches: []types.Entity{askim}}, &checkerMock{})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/beaches", nil))
+	is.Equal(http.StatusOK, w.Code)
+
+	beaches := []map[string]any{}
+	is.NoErr(json.NewDecoder(w.Body).Decode(&beaches))
+	is.Equal(1, len(beaches))
+	is.Equal("Askimsbadet", beaches[0]["name"].(map[string]any)["value"])
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/beaches?id=unknown", nil))
+	is.Equal(http.StatusNotFound, w.Code)
+}
+
+func TestHealth(t *testing.T) {
+	is := is.New(t)
+
+	checker := &checkerMock{status: health.Status{Status: health.Degraded}}
+	r := New(context.Background(), &syncerMock{}, checker)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	is.Equal(http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	is.Equal(http.StatusOK, w.Code) // a degraded service is still ready
+	is.True(strings.Contains(w.Body.String(), `"status":"degraded"`))
+
+	checker.status.Status = health.NotReady
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	is.Equal(http.StatusServiceUnavailable, w.Code)
+}
+
+type checkerMock struct {
+	status health.Status
+}
+
+func (m *checkerMock) Check() health.Status {
+	return m.status
+}
+
+type syncerMock struct {
+	started  []string
+	startErr error
+	last     *report.Report
+	beaches  []types.Entity
+}
+
+func (m *syncerMock) Start(ctx context.Context, sourceID string) error {
+	if m.startErr != nil {
+		return m.startErr
+	}
+	if sourceID == "unknown" {
+		return fmt.Errorf("%w: %s", pipeline.ErrSiteNotFound, sourceID)
+	}
+	m.started = append(m.started, sourceID)
+	return nil
+}
+
+func (m *syncerMock) LastReport() *report.Report {
+	return m.last
+}
+
+func (m *syncerMock) Preview(ctx context.Context, sourceID string) ([]types.Entity, error) {
+	if sourceID != "" {
+		return nil, fmt.Errorf("%w: %s", pipeline.ErrSiteNotFound, sourceID)
+	}
+	return m.beaches, nil
+}